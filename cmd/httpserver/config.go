@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"boot.httpserver/internal/clientkey"
+	"boot.httpserver/internal/server"
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	Listen []ListenConfig `yaml:"listen" json:"listen"`
+	// private address serving pprof and metrics, empty for neither
+	DebugAddr string `yaml:"debug_addr" json:"debug_addr"`
+	// where on DebugAddr metrics are scraped
+	MetricsPath string        `yaml:"metrics_path" json:"metrics_path"`
+	Routes      []RouteConfig `yaml:"routes" json:"routes"`
+	Limits      LimitsConfig  `yaml:"limits" json:"limits"`
+}
+
+type ListenConfig struct {
+	Addr string     `yaml:"addr" json:"addr"`
+	TLS  *TLSConfig `yaml:"tls" json:"tls"`
+}
+
+type TLSConfig struct {
+	Cert string `yaml:"cert" json:"cert"`
+	Key  string `yaml:"key" json:"key"`
+}
+
+// RouteConfig maps a path to exactly one of a static directory, a single
+// file or a set of proxy upstreams. Paths ending in "/" match everything
+// below them. Routes with a host, exact or a "*.example.com" wildcard,
+// only answer for that host; the rest serve every other host
+type RouteConfig struct {
+	Host string `yaml:"host" json:"host"`
+	Path string `yaml:"path" json:"path"`
+
+	Static          string `yaml:"static" json:"static"`
+	ListDirectories bool   `yaml:"list_directories" json:"list_directories"`
+
+	File string `yaml:"file" json:"file"`
+
+	Proxy       []string `yaml:"proxy" json:"proxy"`
+	HealthCheck string   `yaml:"health_check" json:"health_check"`
+	// one of round_robin, least_connections or consistent_hash
+	Balance string `yaml:"balance" json:"balance"`
+	// how long an upstream gets to answer in full, 30s when unset
+	Timeout Duration `yaml:"timeout" json:"timeout"`
+
+	Auth *AuthConfig `yaml:"auth" json:"auth"`
+}
+
+// AuthConfig guards a route with either Basic credentials from an
+// htpasswd file of bcrypt hashes or bearer JWTs signed with HS256
+type AuthConfig struct {
+	Realm    string `yaml:"realm" json:"realm"`
+	Htpasswd string `yaml:"htpasswd" json:"htpasswd"`
+	// file holding the shared HMAC key
+	JWTKeyFile string `yaml:"jwt_key_file" json:"jwt_key_file"`
+	// checked against the token when set
+	Issuer   string `yaml:"issuer" json:"issuer"`
+	Audience string `yaml:"audience" json:"audience"`
+}
+
+type LimitsConfig struct {
+	MaxConns      int `yaml:"max_conns" json:"max_conns"`
+	MaxConnsPerIP int `yaml:"max_conns_per_ip" json:"max_conns_per_ip"`
+	// requests per second and burst per client, 0 disables rate limiting
+	Rate           float64  `yaml:"rate" json:"rate"`
+	Burst          int      `yaml:"burst" json:"burst"`
+	TrustedProxies []string `yaml:"trusted_proxies" json:"trusted_proxies"`
+	// largest request body, before and after Content-Encoding is decoded
+	MaxBodyBytes int64 `yaml:"max_body_bytes" json:"max_body_bytes"`
+	// how long readiness fails before shutting down
+	Drain Duration `yaml:"drain" json:"drain"`
+}
+
+// Duration reads as a string such as "5s" in both YAML and JSON
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// defaultConfig is what runs without a config file
+func defaultConfig() *Config {
+	return &Config{
+		Listen:      []ListenConfig{{Addr: ":42069"}},
+		MetricsPath: "/metrics",
+		Routes: []RouteConfig{
+			{Path: "/video", File: "assets/vim.mp4"},
+			{Path: "/assets/", Static: "assets", ListDirectories: true},
+			{Path: "/httpbin/", Proxy: []string{"https://httpbin.org"}, HealthCheck: "/status/200"},
+		},
+		Limits: LimitsConfig{
+			MaxConns:      1024,
+			MaxConnsPerIP: 64,
+			Rate:          10,
+			Burst:         20,
+			MaxBodyBytes:  10 << 20,
+			Drain:         Duration(5 * time.Second),
+		},
+	}
+}
+
+// loadConfig reads a YAML or, for .json files, JSON config on top of the
+// defaults; lists in the file replace the default ones. Unknown keys are
+// errors so typos don't go unnoticed
+func loadConfig(path string) (*Config, error) {
+	cfg := defaultConfig()
+	if path == "" {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// encoding/json decodes array elements into the ones already there,
+	// which would leak default fields into the file's routes; decode the
+	// lists fresh and only fall back to the defaults when they're absent
+	listen, routes := cfg.Listen, cfg.Routes
+	cfg.Listen, cfg.Routes = nil, nil
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(cfg)
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(cfg)
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if cfg.Listen == nil {
+		cfg.Listen = listen
+	}
+	if cfg.Routes == nil {
+		cfg.Routes = routes
+	}
+	return cfg, nil
+}
+
+var balanceStrategies = []string{"", "round_robin", "least_connections", "consistent_hash"}
+
+// Validate reports every problem at once rather than one per restart.
+// Static content that doesn't exist yet is allowed, it may be deployed
+// after the server starts
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if len(c.Listen) == 0 {
+		fail("listen: at least one address is required")
+	}
+	for i, l := range c.Listen {
+		if _, _, err := net.SplitHostPort(l.Addr); err != nil {
+			fail("listen[%d]: invalid address %q: %v", i, l.Addr, err)
+		}
+		if l.TLS != nil {
+			if l.TLS.Cert == "" || l.TLS.Key == "" {
+				fail("listen[%d]: tls needs both cert and key", i)
+			}
+			for _, file := range []string{l.TLS.Cert, l.TLS.Key} {
+				if _, err := os.Stat(file); file != "" && err != nil {
+					fail("listen[%d]: %v", i, err)
+				}
+			}
+		}
+	}
+	if c.DebugAddr != "" {
+		if _, _, err := net.SplitHostPort(c.DebugAddr); err != nil {
+			fail("debug_addr: invalid address %q: %v", c.DebugAddr, err)
+		}
+	}
+	if !strings.HasPrefix(c.MetricsPath, "/") || strings.HasPrefix(c.MetricsPath, "/debug/pprof/") {
+		fail("metrics_path %q must start with / and stay clear of /debug/pprof/", c.MetricsPath)
+	}
+
+	seen := map[string]bool{}
+	for i, r := range c.Routes {
+		if !strings.HasPrefix(r.Path, "/") {
+			fail("routes[%d]: path %q must start with /", i, r.Path)
+		}
+		if r.Host != "" && !validHostPattern(server.CanonicalHost(r.Host)) {
+			fail("routes[%d]: invalid host %q", i, r.Host)
+		}
+		key := server.CanonicalHost(r.Host) + r.Path
+		if seen[key] {
+			fail("routes[%d]: duplicate path %q", i, r.Path)
+		}
+		seen[key] = true
+
+		targets := 0
+		for _, set := range []bool{r.Static != "", r.File != "", len(r.Proxy) > 0} {
+			if set {
+				targets++
+			}
+		}
+		if targets != 1 {
+			fail("routes[%d]: %s needs exactly one of static, file or proxy", i, r.Path)
+		}
+		if r.Static != "" && !strings.HasSuffix(r.Path, "/") {
+			fail("routes[%d]: static path %q must end with /", i, r.Path)
+		}
+		if info, err := os.Stat(r.Static); r.Static != "" && err == nil && !info.IsDir() {
+			fail("routes[%d]: static root %q is not a directory", i, r.Static)
+		}
+		if info, err := os.Stat(r.File); r.File != "" && err == nil && info.IsDir() {
+			fail("routes[%d]: file %q is a directory", i, r.File)
+		}
+		for _, upstream := range r.Proxy {
+			u, err := url.Parse(upstream)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				fail("routes[%d]: proxy upstream %q must be an http or https URL", i, upstream)
+			}
+		}
+		if r.HealthCheck != "" && !strings.HasPrefix(r.HealthCheck, "/") {
+			fail("routes[%d]: health_check %q must start with /", i, r.HealthCheck)
+		}
+		if r.Timeout < 0 {
+			fail("routes[%d]: timeout must not be negative", i)
+		}
+		if !slices.Contains(balanceStrategies, r.Balance) {
+			fail("routes[%d]: unknown balance strategy %q", i, r.Balance)
+		}
+		if a := r.Auth; a != nil {
+			if (a.Htpasswd == "") == (a.JWTKeyFile == "") {
+				fail("routes[%d]: auth needs exactly one of htpasswd or jwt_key_file", i)
+			}
+			for _, file := range []string{a.Htpasswd, a.JWTKeyFile} {
+				if _, err := os.Stat(file); file != "" && err != nil {
+					fail("routes[%d]: %v", i, err)
+				}
+			}
+		}
+	}
+
+	l := c.Limits
+	if l.MaxConns < 0 || l.MaxConnsPerIP < 0 || l.Burst < 0 || l.MaxBodyBytes < 0 || l.Rate < 0 || l.Drain < 0 {
+		fail("limits: values must not be negative")
+	}
+	if l.Rate > 0 && l.Burst < 1 {
+		fail("limits: burst must be at least 1 when rate is set")
+	}
+	if l.MaxBodyBytes == 0 {
+		fail("limits: max_body_bytes is required")
+	}
+	if _, err := clientkey.ClientIP(l.TrustedProxies...); err != nil {
+		fail("limits: %v", err)
+	}
+	return errors.Join(errs...)
+}
+
+// validHostPattern accepts "example.com" and "*.example.com"
+func validHostPattern(host string) bool {
+	host = strings.TrimPrefix(host, "*.")
+	if host == "" {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
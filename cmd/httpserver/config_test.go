@@ -0,0 +1,109 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	// Test: the example config is valid
+	cfg, err := loadConfig("config.example.yaml")
+	require.NoError(t, err)
+	require.NoError(t, cfg.Validate())
+	assert.Equal(t, 5*time.Second, time.Duration(cfg.Limits.Drain))
+
+	// Test: YAML overrides the defaults
+	cfg, err = loadConfig(writeConfig(t, "c.yaml", "listen:\n  - addr: 127.0.0.1:8080\nlimits:\n  rate: 1\n  drain: 1m\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []ListenConfig{{Addr: "127.0.0.1:8080"}}, cfg.Listen)
+	assert.Equal(t, 1.0, cfg.Limits.Rate)
+	assert.Equal(t, 20, cfg.Limits.Burst)
+	assert.Equal(t, time.Minute, time.Duration(cfg.Limits.Drain))
+
+	// Test: JSON
+	cfg, err = loadConfig(writeConfig(t, "c.json", `{"routes": [{"path": "/up/", "proxy": ["http://localhost:9000"]}], "limits": {"drain": "2s"}}`))
+	require.NoError(t, err)
+	assert.Equal(t, []RouteConfig{{Path: "/up/", Proxy: []string{"http://localhost:9000"}}}, cfg.Routes)
+	assert.Equal(t, defaultConfig().Listen, cfg.Listen)
+	assert.Equal(t, 2*time.Second, time.Duration(cfg.Limits.Drain))
+	assert.NoError(t, cfg.Validate())
+
+	// Test: unknown keys are rejected
+	_, err = loadConfig(writeConfig(t, "c.yaml", "listn: []\n"))
+	assert.ErrorContains(t, err, "listn")
+	_, err = loadConfig(writeConfig(t, "c.json", `{"limits": {"rte": 1}}`))
+	assert.ErrorContains(t, err, "rte")
+
+	// Test: an empty file keeps the defaults
+	cfg, err = loadConfig(writeConfig(t, "c.yaml", ""))
+	require.NoError(t, err)
+	assert.Equal(t, defaultConfig(), cfg)
+}
+
+func TestValidate(t *testing.T) {
+	require.NoError(t, defaultConfig().Validate())
+
+	cfg := defaultConfig()
+	cfg.Listen = []ListenConfig{{Addr: "42069"}, {Addr: ":443", TLS: &TLSConfig{Cert: "missing.pem"}}}
+	cfg.MetricsPath = "metrics"
+	cfg.Routes = []RouteConfig{
+		{Path: "assets/", Static: "assets"},
+		{Path: "/both", File: "a", Proxy: []string{"http://x"}},
+		{Path: "/both", Proxy: []string{"ftp://x"}, Balance: "random"},
+		{Path: "/static", Static: "."},
+		{Host: "ex ample.com", Path: "/h", File: "a"},
+		{Path: "/admin/", Proxy: []string{"http://x"}, Auth: &AuthConfig{}},
+		{Path: "/api/", Proxy: []string{"http://x"}, Auth: &AuthConfig{JWTKeyFile: "missing.key"}},
+	}
+	cfg.Limits.Rate, cfg.Limits.Burst = 5, 0
+	cfg.Limits.TrustedProxies = []string{"nope"}
+
+	err := cfg.Validate()
+	require.Error(t, err)
+	for _, problem := range []string{
+		`listen[0]: invalid address "42069"`,
+		"listen[1]: tls needs both cert and key",
+		"listen[1]: stat missing.pem",
+		`metrics_path "metrics" must start with /`,
+		`routes[0]: path "assets/" must start with /`,
+		"routes[1]: /both needs exactly one of static, file or proxy",
+		`routes[2]: duplicate path "/both"`,
+		`routes[2]: proxy upstream "ftp://x" must be an http or https URL`,
+		`routes[2]: unknown balance strategy "random"`,
+		`routes[3]: static path "/static" must end with /`,
+		`routes[4]: invalid host "ex ample.com"`,
+		"routes[5]: auth needs exactly one of htpasswd or jwt_key_file",
+		"routes[6]: stat missing.key",
+		"limits: burst must be at least 1",
+		`limits: invalid trusted proxy "nope"`,
+	} {
+		assert.ErrorContains(t, err, problem)
+	}
+
+	// Test: host names differing only in case or a trailing dot collide
+	cfg = defaultConfig()
+	cfg.Routes = []RouteConfig{
+		{Host: "Example.com", Path: "/a", File: "a"},
+		{Host: "example.com.", Path: "/a", File: "a"},
+	}
+	assert.ErrorContains(t, cfg.Validate(), `routes[1]: duplicate path "/a"`)
+
+	// Test: the same path may be routed on different hosts
+	cfg = defaultConfig()
+	cfg.Routes = append(cfg.Routes,
+		RouteConfig{Host: "static.example.com", Path: "/video", File: "a"},
+		RouteConfig{Host: "*.example.com", Path: "/video", File: "a"},
+	)
+	assert.NoError(t, cfg.Validate())
+}
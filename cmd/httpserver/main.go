@@ -2,130 +2,339 @@ package main
 
 import (
 	"crypto/sha256"
+	"crypto/tls"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"reflect"
+	"slices"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
+	"time"
 
+	"boot.httpserver/internal/balancer"
+	"boot.httpserver/internal/debug"
 	"boot.httpserver/internal/headers"
+	"boot.httpserver/internal/health"
+	"boot.httpserver/internal/metrics"
 	"boot.httpserver/internal/request"
 	"boot.httpserver/internal/response"
 	"boot.httpserver/internal/server"
+	"boot.httpserver/internal/sse"
+	"boot.httpserver/internal/tracing"
+	"boot.httpserver/internal/websocket"
 )
 
-const port = 42069
+var checker = health.New()
+
+var tracer = tracing.NewTracer(logExporter{})
+
+// logExporter prints finished spans until we ship them to a collector
+type logExporter struct{}
+
+func (logExporter) ExportSpan(span *tracing.Span) {
+	sc := span.SpanContext()
+	log.Printf("span %s trace=%s span=%s parent=%s duration=%s err=%v",
+		span.Name, sc.TraceID, sc.SpanID, span.Parent, span.EndTime.Sub(span.StartTime), span.Err)
+}
 
 func main() {
-	srv, err := server.Serve(port, handler)
+	configPath := flag.String("config", "", "YAML or JSON config file (.json for JSON)")
+	listen := flag.String("listen", "", "comma separated addresses to listen on, replacing the configured ones")
+	debugAddr := flag.String("debug-addr", "", "address to serve pprof profiles on")
+	flag.Parse()
+
+	// flags win over the file, on every reload too
+	load := func() (*Config, error) {
+		cfg, err := loadConfig(*configPath)
+		if err != nil {
+			return nil, err
+		}
+		if *listen != "" {
+			cfg.Listen = nil
+			for _, addr := range strings.Split(*listen, ",") {
+				cfg.Listen = append(cfg.Listen, ListenConfig{Addr: strings.TrimSpace(addr)})
+			}
+		}
+		if *debugAddr != "" {
+			cfg.DebugAddr = *debugAddr
+		}
+		return cfg, cfg.Validate()
+	}
+
+	cfg, err := load()
 	if err != nil {
-		log.Fatalf("Error starting server: %v", err)
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	current, err := newSite(cfg)
+	if err != nil {
+		log.Fatalf("Error building site: %v", err)
+	}
+	var active atomic.Pointer[site]
+	active.Store(current)
+	root := func(w *response.Writer, req *request.Request) {
+		active.Load().handler(w, req)
+	}
+
+	registry := metrics.NewRegistry()
+	opts := []server.Option{
+		server.WithMaxConns(cfg.Limits.MaxConns),
+		server.WithMaxConnsPerIP(cfg.Limits.MaxConnsPerIP),
+		server.WithMaxBodyBytes(cfg.Limits.MaxBodyBytes),
+		server.WithMetrics(server.NewMetrics(registry)),
+	}
+	for _, l := range cfg.Listen {
+		listenOpts := opts
+		if l.TLS != nil {
+			cert, err := tls.LoadX509KeyPair(l.TLS.Cert, l.TLS.Key)
+			if err != nil {
+				log.Fatalf("Error loading TLS certificate for %s: %v", l.Addr, err)
+			}
+			listenOpts = append(slices.Clone(opts), server.WithTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}}))
+		}
+		srv, err := server.ServeAddr(l.Addr, root, listenOpts...)
+		if err != nil {
+			log.Fatalf("Error starting server: %v", err)
+		}
+		defer srv.Close()
+		log.Printf("Server listening on %s\n", srv.Addr())
+	}
+
+	// profiles and metrics are only served when asked for, and never on
+	// the public port
+	if cfg.DebugAddr != "" {
+		debugMux := debug.NewMux()
+		debugMux.Handle("GET", cfg.MetricsPath, server.MetricsHandler(registry))
+		debugSrv, err := server.ServeAddr(cfg.DebugAddr, debugMux.ServeRequest)
+		if err != nil {
+			log.Fatalf("Error starting debug server: %v", err)
+		}
+		defer debugSrv.Close()
+		log.Printf("Debug server listening on %s\n", debugSrv.Addr())
 	}
-	defer srv.Close()
-	log.Printf("Server started on port: %d\n", port)
+	checker.SetReady(true)
+	started := cfg
 
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range sigChan {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		next, err := load()
+		if err != nil {
+			log.Printf("Keeping the current configuration: %v\n", err)
+			continue
+		}
+		if restartRequired(started, next) {
+			log.Printf("Listen addresses, TLS, connection and body limits only change on restart\n")
+		}
+		s, err := newSite(next)
+		if err != nil {
+			log.Printf("Keeping the current configuration: %v\n", err)
+			continue
+		}
+		active.Swap(s).Close()
+		cfg = next
+		log.Printf("Configuration reloaded\n")
+	}
+
+	// fail readiness first so the orchestrator stops routing to us
+	checker.SetReady(false)
+	drain := time.Duration(cfg.Limits.Drain)
+	log.Printf("Draining for %s\n", drain)
+	time.Sleep(drain)
+	active.Load().Close()
 	log.Printf("Server gracefully stopped\n")
 }
 
+// restartRequired reports whether next changes what the listeners were
+// started with, which a reload can't apply
+func restartRequired(started, next *Config) bool {
+	return !reflect.DeepEqual(next.Listen, started.Listen) ||
+		next.DebugAddr != started.DebugAddr ||
+		next.MetricsPath != started.MetricsPath ||
+		next.Limits.MaxConns != started.Limits.MaxConns ||
+		next.Limits.MaxConnsPerIP != started.Limits.MaxConnsPerIP ||
+		next.Limits.MaxBodyBytes != started.Limits.MaxBodyBytes
+}
+
+var pageOffers = []string{"text/html", "application/json", "text/plain"}
+
 func handler(w *response.Writer, req *request.Request) {
 	statusCode := response.OK
+	message := "Your request was an absolute banger."
 	body := "<html>\n  <head>\n    <title>200 OK</title>\n  </head>\n  <body>\n    <h1>Success!</h1>\n    <p>Your request was an absolute banger.</p>\n  </body>\n</html>\r\n"
-	if req.RequestLine.RequestTarget == "/yourproblem" {
+	if req.Path() == "/yourproblem" {
 		statusCode = response.BADREQUEST
+		message = "Your request honestly kinda sucked."
 		body = "<html>\n  <head>\n    <title>400 Bad Request</title>\n  </head>\n  <body>\n    <h1>Bad Request</h1>\n    <p>Your request honestly kinda sucked.</p>\n  </body>\n</html>\r\n"
 	}
-	if req.RequestLine.RequestTarget == "/myproblem" {
+	if req.Path() == "/myproblem" {
 		statusCode = response.INTERNALERROR
+		message = "Okay, you know what? This one is on me."
 		body = "<html>\n  <head>\n    <title>500 Internal Server Error</title>\n  </head>\n  <body>\n    <h1>Internal Server Error</h1>\n    <p>Okay, you know what? This one is on me.</p>\n  </body>\n</html>\r\n"
 	}
 
-	err := w.WriteStatusLine(statusCode)
-	if err != nil {
+	w.Header().Set("Vary", "Accept")
+	contentType, negotiated := response.Negotiate(req.Headers, pageOffers)
+	if negotiated != response.OK {
+		herr := &server.HandlerError{StatusCode: int(negotiated), Message: "available as " + strings.Join(pageOffers, ", ")}
+		herr.Write(w, req)
+		return
+	}
+	if contentType == "application/json" {
+		response.WriteJSON(w, statusCode, map[string]string{"message": message})
+		return
+	}
+
+	if contentType == "text/plain" {
+		body = message + "\n"
+	}
+	w.Header().Set("Content-Type", contentType)
+	if err := w.WriteHeader(statusCode); err != nil {
 		log.Printf("error writing status line: %v", err)
+		return
 	}
+	io.WriteString(w, body)
+}
 
-	h := response.GetDefaultHeaders(len(body))
+func echoWebSocket(w *response.Writer, req *request.Request) {
+	conn, err := websocket.Upgrade(w, req)
+	if err != nil {
+		log.Printf("error upgrading to websocket: %v", err)
+		return
+	}
+	defer conn.NetConn().Close()
 
-	if req.RequestLine.RequestTarget == "/video" {
-		videoHandler(w, h, req.RequestLine.RequestTarget)
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			log.Printf("websocket closed: %v", err)
+			return
+		}
+		if err := conn.WriteMessage(messageType, data); err != nil {
+			log.Printf("error writing websocket message: %v", err)
+			return
+		}
+	}
+}
+
+func eventsHandler(w *response.Writer, req *request.Request) {
+	stream, err := sse.NewStream(w, req)
+	if err != nil {
+		log.Printf("error starting event stream: %v", err)
 		return
 	}
+	defer stream.Close()
+	stream.Heartbeat(15 * time.Second)
 
-	if proxying, target := shouldProxy(req); proxying {
-		proxyRequest(w, h, target)
+	// resume counting after the last tick the client saw
+	start, _ := strconv.Atoi(stream.LastEventID)
+	for i := start + 1; i <= start+10; i++ {
+		err := stream.Send(sse.Event{
+			ID:    strconv.Itoa(i),
+			Event: "tick",
+			Data:  time.Now().Format(time.RFC3339),
+		})
+		if err != nil {
+			log.Printf("event stream closed: %v", err)
+			return
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func proxyRequest(w *response.Writer, req *request.Request, pool *balancer.Pool, client *http.Client, target string) {
+	upstream, err := pool.Pick(req)
+	if err != nil {
+		writeProxyError(w, req, response.SERVICEUNAVAILABLE, err)
 		return
 	}
 
-	h.Set("Content-Type", "text/html")
-	err = w.WriteHeaders(h)
+	log.Printf("proxying %s to %s%s\n", target, upstream.URL, target)
+	ctx, span := tracer.Start(req.Context(), "proxy GET", tracing.SpanKindClient)
+	defer span.End()
+	span.SetAttribute("server.address", upstream.URL)
+	span.SetAttribute("url.path", target)
 
-	w.WriteBody([]byte(body))
-}
+	outReq, err := http.NewRequestWithContext(ctx, "GET", upstream.URL+target, nil)
+	if err != nil {
+		span.SetError(err)
+		pool.Release(upstream)
+		writeProxyError(w, req, response.BADGATEWAY, err)
+		return
+	}
+	tracing.Inject(ctx, outReq.Header)
+	res, err := client.Do(outReq)
+	if err != nil {
+		span.SetError(err)
+		pool.Done(upstream, err)
+		writeProxyError(w, req, response.BADGATEWAY, err)
+		return
+	}
+	defer res.Body.Close()
+	span.SetAttribute("http.response.status_code", strconv.Itoa(res.StatusCode))
 
-func shouldProxy(req *request.Request) (bool, string) {
-	hasPrefix := strings.HasPrefix(req.RequestLine.RequestTarget, "/httpbin")
-	if !hasPrefix {
-		return false, ""
+	var upstreamErr error
+	if res.StatusCode >= 500 {
+		upstreamErr = fmt.Errorf("upstream responded %s", res.Status)
+		span.SetError(upstreamErr)
 	}
-	target := req.RequestLine.RequestTarget
-	target = strings.TrimPrefix(target, "/httpbin")
-	return true, target
-}
 
-func proxyRequest(w *response.Writer, headers headers.Headers, target string) {
-	delete(headers, "Content-Length")
-	headers.Set("Transfer-Encoding", "chunked")
-	headers.Set("Trailer", "X-Content-Sha256, X-Content-Length")
+	copyUpstreamHeaders(w.Header(), res.Header)
+	w.Header().Set("Transfer-Encoding", "chunked")
+	w.Header().Set("Trailer", "X-Content-Sha256, X-Content-Length")
+	w.WriteHeader(response.StatusCode(res.StatusCode))
 
-	w.WriteHeaders(headers)
-	res, err := http.Get("https://httpbin.org" + target)
-	log.Printf("proxying %s to https://httpbin.org%s\n", target, target)
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(w, hash), res.Body)
 	if err != nil {
-		log.Printf("error proxying request: %v", err)
+		log.Printf("error proxying response: %v", err)
+		upstreamErr = err
 	}
-	buff := make([]byte, 1024)
-	totalBuff := make([]byte, 0, 1024)
+	w.WriteChunkedBodyDone()
+	w.WriteTrailers(map[string]string{
+		"X-Content-Sha256": fmt.Sprintf("%x", hash.Sum(nil)),
+		"X-Content-Length": strconv.FormatInt(n, 10),
+	})
+	pool.Done(upstream, upstreamErr)
+}
 
-	for {
-		n, e := res.Body.Read(buff)
-		totalBuff = append(totalBuff, buff[:n]...)
+var hopByHopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Proxy-Connection", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
 
-		log.Printf("chunking %d bytes\n", n)
-		if e == io.EOF {
-			log.Printf("EOF | ending proxying: %v", e)
-			break
-		}
-		if e != nil {
-			log.Printf("error proxying response: %v", e)
-			break
-		}
-		_, e = w.WriteChunkedBody(buff[:n])
-		if e != nil {
-			log.Printf("error proxying response: %v", e)
+// copyUpstreamHeaders passes on the upstream's end-to-end headers.
+// Hop-by-hop ones, including any the upstream names in Connection, stay
+// behind, and so does Content-Length since the body is sent chunked
+func copyUpstreamHeaders(h headers.Headers, upstream http.Header) {
+	skip := map[string]bool{"Content-Length": true}
+	for _, name := range hopByHopHeaders {
+		skip[name] = true
+	}
+	for _, value := range upstream.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			skip[http.CanonicalHeaderKey(strings.TrimSpace(name))] = true
 		}
 	}
-	hash := sha256.Sum256(totalBuff)
-	trailers := map[string]string{
-		"X-Content-Sha256": fmt.Sprintf("%x", hash),
-		"X-Content-Length": fmt.Sprintf("%d", len(totalBuff)),
+	for name, values := range upstream {
+		if !skip[name] {
+			h.Set(name, strings.Join(values, ", "))
+		}
 	}
-	w.WriteChunkedBodyDone()
-	w.WriteTrailers(trailers)
 }
 
-func videoHandler(w *response.Writer, headers headers.Headers, target string) {
-	delete(headers, "Content-Length")
-	headers.Set("Content-Type", "video/mp4")
-	w.WriteHeaders(headers)
-	data, err := os.ReadFile("assets/vim.mp4")
-	if err != nil {
-		log.Printf("error reading video")
-	}
-	w.WriteBody(data)
+// writeProxyError logs what went wrong and tells the client only the
+// status, since errors name upstream addresses
+func writeProxyError(w *response.Writer, req *request.Request, statusCode response.StatusCode, err error) {
+	log.Printf("error proxying request: %v", err)
+	server.WriteError(w, req, statusCode, strings.ToLower(response.StatusText(statusCode)))
 }
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"boot.httpserver/internal/balancer"
+	"boot.httpserver/internal/clientkey"
+	"boot.httpserver/internal/fileserver"
+	"boot.httpserver/internal/middleware"
+	"boot.httpserver/internal/request"
+	"boot.httpserver/internal/response"
+	"boot.httpserver/internal/server"
+)
+
+// how long an upstream gets to answer in full unless the route says
+const defaultProxyTimeout = 30 * time.Second
+
+// site is the handler built from one configuration. A reload builds a
+// new site and retires the old one
+type site struct {
+	handler server.Handler
+	pools   []*balancer.Pool
+}
+
+func newSite(cfg *Config) (*site, error) {
+	s := &site{}
+	mux := server.NewMux()
+	mux.Handle("GET", "/", handler)
+	mux.Handle("GET", "/ws", echoWebSocket)
+	mux.Handle("GET", "/events", eventsHandler)
+	hosts := server.NewHostMux()
+	hosts.HandleDefault(mux.ServeRequest)
+	hostMuxes := map[string]*server.Mux{}
+	for _, route := range cfg.Routes {
+		h, err := s.routeHandler(route)
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("route %s%s: %w", route.Host, route.Path, err)
+		}
+		if route.Host == "" {
+			mux.Handle("GET", route.Path, h)
+			continue
+		}
+		host := server.CanonicalHost(route.Host)
+		hostMux, ok := hostMuxes[host]
+		if !ok {
+			hostMux = server.NewMux()
+			hostMuxes[host] = hostMux
+			hosts.Handle(host, hostMux.ServeRequest)
+		}
+		hostMux.Handle("GET", route.Path, h)
+	}
+
+	middlewares := []server.Middleware{
+		middleware.Trace(tracer),
+		middleware.CORS(middleware.CORSOptions{
+			AllowedOriginPatterns: []*regexp.Regexp{regexp.MustCompile(`^https?://(localhost|127\.0\.0\.1)(:\d+)?$`)},
+			AllowedMethods:        []string{"GET", "HEAD", "POST"},
+			AllowedHeaders:        []string{"Content-Type", "Last-Event-ID"},
+			ExposedHeaders:        []string{"X-Content-Sha256", "X-Content-Length"},
+			MaxAge:                time.Hour,
+		}),
+	}
+	if cfg.Limits.Rate > 0 {
+		clientIP, err := clientkey.ClientIP(cfg.Limits.TrustedProxies...)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		limiter := middleware.NewRateLimiter(cfg.Limits.Rate, cfg.Limits.Burst, clientIP)
+		middlewares = append(middlewares, middleware.RateLimit(limiter))
+	}
+	middlewares = append(middlewares,
+		middleware.Compress(gzip.DefaultCompression),
+		middleware.DecompressBody(cfg.Limits.MaxBodyBytes),
+	)
+	app := server.Chain(hosts.ServeRequest, middlewares...)
+	// probes come before the middleware so orchestrators polling from one
+	// address are never rate limited or traced, whatever Host they send
+	s.handler = func(w *response.Writer, req *request.Request) {
+		method := req.RequestLine.Method
+		if method == "GET" || method == "HEAD" {
+			switch req.Path() {
+			case "/healthz":
+				checker.Healthz(w, req)
+				return
+			case "/readyz":
+				checker.Readyz(w, req)
+				return
+			}
+		}
+		app(w, req)
+	}
+	return s, nil
+}
+
+func (s *site) routeHandler(route RouteConfig) (server.Handler, error) {
+	h, err := s.targetHandler(route)
+	if err != nil || route.Auth == nil {
+		return h, err
+	}
+	auth, err := authMiddleware(route.Auth)
+	if err != nil {
+		return nil, err
+	}
+	return auth(h), nil
+}
+
+// authMiddleware reads the credentials fresh, so a reload picks up
+// changed htpasswd and key files
+func authMiddleware(cfg *AuthConfig) (server.Middleware, error) {
+	realm := cfg.Realm
+	if realm == "" {
+		realm = "restricted"
+	}
+	if cfg.Htpasswd != "" {
+		users, err := middleware.LoadHtpasswd(cfg.Htpasswd)
+		if err != nil {
+			return nil, err
+		}
+		return middleware.BasicAuth(realm, users), nil
+	}
+	key, err := os.ReadFile(cfg.JWTKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := middleware.NewHMACVerifier("HS256", bytes.TrimSpace(key))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", cfg.JWTKeyFile, err)
+	}
+	verifier.Issuer, verifier.Audience = cfg.Issuer, cfg.Audience
+	return middleware.BearerAuth(realm, verifier), nil
+}
+
+func (s *site) targetHandler(route RouteConfig) (server.Handler, error) {
+	switch {
+	case route.Static != "":
+		warnMissing(route.Static)
+		fs := fileserver.New(route.Path, route.Static)
+		fs.ListDirectories = route.ListDirectories
+		return fs.Handle, nil
+	case route.File != "":
+		warnMissing(route.File)
+		return func(w *response.Writer, req *request.Request) {
+			fileserver.ServeFile(w, req, route.File)
+		}, nil
+	}
+
+	var strategy balancer.Strategy
+	switch route.Balance {
+	case "least_connections":
+		strategy = balancer.NewLeastConnections()
+	case "consistent_hash":
+		strategy = balancer.NewConsistentHash(100)
+	default:
+		strategy = balancer.NewRoundRobin()
+	}
+	pool, err := balancer.NewPool(strategy, route.Proxy...)
+	if err != nil {
+		return nil, err
+	}
+	if route.HealthCheck != "" {
+		pool.StartHealthChecks(route.HealthCheck, 10*time.Second, 2*time.Second)
+	}
+	s.pools = append(s.pools, pool)
+
+	timeout := time.Duration(route.Timeout)
+	if timeout == 0 {
+		timeout = defaultProxyTimeout
+	}
+	client := &http.Client{Timeout: timeout}
+	prefix := strings.TrimSuffix(route.Path, "/")
+	return func(w *response.Writer, req *request.Request) {
+		proxyRequest(w, req, pool, client, strings.TrimPrefix(req.RequestLine.RequestTarget, prefix))
+	}, nil
+}
+
+func warnMissing(path string) {
+	if _, err := os.Stat(path); err != nil {
+		log.Printf("warning: %v", err)
+	}
+}
+
+// Close stops the upstream health checks; requests still running on the
+// site finish normally
+func (s *site) Close() {
+	for _, pool := range s.pools {
+		pool.Close()
+	}
+}
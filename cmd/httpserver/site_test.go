@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"boot.httpserver/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveSite(s *site, target string) string {
+	return serveSiteHost(s, "localhost", target)
+}
+
+func serveSiteHost(s *site, host, target string) string {
+	req := testutil.NewRequest("GET", target, map[string]string{"host": host})
+	req.RemoteAddr = "10.0.0.1:5000"
+	return testutil.Serve(s.handler, req)
+}
+
+func TestSiteProbesSkipRateLimit(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Routes = nil
+	cfg.Limits.Rate, cfg.Limits.Burst = 1, 1
+	s, err := newSite(cfg)
+	require.NoError(t, err)
+	defer s.Close()
+
+	// Test: the rest of the site is limited
+	serveSite(s, "/")
+	assert.Contains(t, serveSite(s, "/"), "HTTP/1.1 429 Too Many Requests\r\n")
+
+	// Test: probes keep answering from the same address
+	for range 3 {
+		out := serveSite(s, "/healthz")
+		assert.Contains(t, out, "HTTP/1.1 200 OK\r\n")
+		assert.NotContains(t, out, "RateLimit-Limit")
+	}
+}
+
+func TestSiteHostRoutes(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("file "+name), 0o644))
+	}
+	cfg := defaultConfig()
+	cfg.Limits.Rate = 0
+	cfg.Routes = []RouteConfig{
+		{Host: "Example.com", Path: "/a", File: filepath.Join(dir, "a.txt")},
+		{Host: "example.com.", Path: "/b", File: filepath.Join(dir, "b.txt")},
+	}
+	require.NoError(t, cfg.Validate())
+	s, err := newSite(cfg)
+	require.NoError(t, err)
+	defer s.Close()
+
+	// Test: spellings of one host share its routes
+	assert.Contains(t, serveSiteHost(s, "example.com", "/a"), "file a.txt")
+	assert.Contains(t, serveSiteHost(s, "EXAMPLE.com:8080", "/b"), "file b.txt")
+	// Test: other hosts fall through to the default routes
+	assert.NotContains(t, serveSiteHost(s, "other.org", "/a"), "file a.txt")
+}
+
+func TestSiteProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Connection", "X-Hop")
+		w.Header().Set("X-Hop", "1")
+		w.Header().Set("X-Upstream", "yes")
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte(`{"short":"stout"}`))
+	}))
+	defer upstream.Close()
+
+	cfg := defaultConfig()
+	cfg.Limits.Rate = 0
+	cfg.Routes = []RouteConfig{{Path: "/up/", Proxy: []string{upstream.URL}, Timeout: Duration(50 * time.Millisecond)}}
+	require.NoError(t, cfg.Validate())
+	s, err := newSite(cfg)
+	require.NoError(t, err)
+	defer s.Close()
+
+	// Test: the upstream's status and end-to-end headers reach the client
+	out := serveSite(s, "/up/tea")
+	assert.Contains(t, out, "HTTP/1.1 418 \r\n")
+	assert.Contains(t, out, "Content-Type: application/json\r\n")
+	assert.Contains(t, out, "X-Upstream: yes\r\n")
+	assert.NotContains(t, out, "X-Hop")
+	assert.Contains(t, out, `{"short":"stout"}`)
+
+	// Test: an upstream slower than the route timeout is a bad gateway,
+	// without telling the client where the upstream lives
+	out = serveSite(s, "/up/slow")
+	assert.Contains(t, out, "HTTP/1.1 502 Bad Gateway\r\n")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\nbad gateway"))
+	assert.NotContains(t, out, "127.0.0.1")
+}
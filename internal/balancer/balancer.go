@@ -0,0 +1,264 @@
+package balancer
+
+import (
+	"errors"
+	"hash/crc32"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"boot.httpserver/internal/clientkey"
+	"boot.httpserver/internal/request"
+)
+
+var ErrNoUpstream = errors.New("no healthy upstream available")
+
+type Upstream struct {
+	URL string
+
+	active       atomic.Int64
+	healthy      atomic.Bool
+	mu           sync.Mutex
+	failures     int
+	ejectedUntil time.Time
+}
+
+func (u *Upstream) ActiveConnections() int64 {
+	return u.active.Load()
+}
+
+func (u *Upstream) Available() bool {
+	if !u.healthy.Load() {
+		return false
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return !time.Now().Before(u.ejectedUntil)
+}
+
+type Strategy interface {
+	Pick(upstreams []*Upstream, key string) *Upstream
+}
+
+type RoundRobin struct {
+	next atomic.Uint64
+}
+
+func NewRoundRobin() *RoundRobin {
+	return &RoundRobin{}
+}
+
+func (rr *RoundRobin) Pick(upstreams []*Upstream, key string) *Upstream {
+	n := uint64(len(upstreams))
+	start := rr.next.Add(1) - 1
+	for i := uint64(0); i < n; i++ {
+		u := upstreams[(start+i)%n]
+		if u.Available() {
+			return u
+		}
+	}
+	return nil
+}
+
+type LeastConnections struct{}
+
+func NewLeastConnections() *LeastConnections {
+	return &LeastConnections{}
+}
+
+func (lc *LeastConnections) Pick(upstreams []*Upstream, key string) *Upstream {
+	var best *Upstream
+	for _, u := range upstreams {
+		if !u.Available() {
+			continue
+		}
+		if best == nil || u.ActiveConnections() < best.ActiveConnections() {
+			best = u
+		}
+	}
+	return best
+}
+
+const defaultReplicas = 100
+
+type ConsistentHash struct {
+	replicas int
+
+	mu     sync.Mutex
+	ring   []uint32
+	owners map[uint32]*Upstream
+	built  []*Upstream
+}
+
+func NewConsistentHash(replicas int) *ConsistentHash {
+	if replicas <= 0 {
+		replicas = defaultReplicas
+	}
+	return &ConsistentHash{replicas: replicas}
+}
+
+func (ch *ConsistentHash) build(upstreams []*Upstream) {
+	ch.ring = make([]uint32, 0, len(upstreams)*ch.replicas)
+	ch.owners = make(map[uint32]*Upstream, len(upstreams)*ch.replicas)
+	for _, u := range upstreams {
+		for i := 0; i < ch.replicas; i++ {
+			h := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + "#" + u.URL))
+			if _, taken := ch.owners[h]; taken {
+				continue
+			}
+			ch.owners[h] = u
+			ch.ring = append(ch.ring, h)
+		}
+	}
+	slices.Sort(ch.ring)
+	ch.built = slices.Clone(upstreams)
+}
+
+// the ring always holds every upstream so that ejecting one only remaps
+// the keys it owned; unavailable owners are skipped clockwise
+func (ch *ConsistentHash) Pick(upstreams []*Upstream, key string) *Upstream {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	if !slices.Equal(ch.built, upstreams) {
+		ch.build(upstreams)
+	}
+	if len(ch.ring) == 0 {
+		return nil
+	}
+
+	h := crc32.ChecksumIEEE([]byte(key))
+	start := sort.Search(len(ch.ring), func(i int) bool { return ch.ring[i] >= h })
+	for i := 0; i < len(ch.ring); i++ {
+		u := ch.owners[ch.ring[(start+i)%len(ch.ring)]]
+		if u.Available() {
+			return u
+		}
+	}
+	return nil
+}
+
+type Pool struct {
+	// consecutive failures before an upstream is passively ejected
+	MaxFails int
+	// how long an ejected upstream is kept out of rotation
+	EjectFor time.Duration
+	// key used by hashing strategies, defaults to the client IP
+	Key clientkey.Func
+
+	strategy  Strategy
+	upstreams []*Upstream
+	client    *http.Client
+	stop      chan struct{}
+	stopOnce  sync.Once
+}
+
+func NewPool(strategy Strategy, urls ...string) (*Pool, error) {
+	if len(urls) == 0 {
+		return nil, errors.New("pool needs at least one upstream")
+	}
+	p := &Pool{
+		MaxFails: 3,
+		EjectFor: 30 * time.Second,
+		Key:      clientkey.RemoteIP,
+		strategy: strategy,
+		client:   &http.Client{},
+		stop:     make(chan struct{}),
+	}
+	for _, url := range urls {
+		u := &Upstream{URL: url}
+		u.healthy.Store(true)
+		p.upstreams = append(p.upstreams, u)
+	}
+	return p, nil
+}
+
+func (p *Pool) Upstreams() []*Upstream {
+	return p.upstreams
+}
+
+// Pick selects an upstream for req and counts it as an active connection
+// until Done is called
+func (p *Pool) Pick(req *request.Request) (*Upstream, error) {
+	key := ""
+	if p.Key != nil {
+		key = p.Key(req)
+	}
+	u := p.strategy.Pick(p.upstreams, key)
+	if u == nil {
+		return nil, ErrNoUpstream
+	}
+	u.active.Add(1)
+	return u, nil
+}
+
+// Release gives back an upstream returned by Pick without judging its
+// health, for requests that never reached it
+func (p *Pool) Release(u *Upstream) {
+	u.active.Add(-1)
+}
+
+// Done releases an upstream returned by Pick once it was contacted; a
+// non-nil err counts towards passive ejection, success resets the count
+func (p *Pool) Done(u *Upstream, err error) {
+	p.Release(u)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if err == nil {
+		u.failures = 0
+		return
+	}
+	u.failures++
+	if p.MaxFails > 0 && u.failures >= p.MaxFails {
+		u.failures = 0
+		u.ejectedUntil = time.Now().Add(p.EjectFor)
+	}
+}
+
+// StartHealthChecks probes path on every upstream each interval and
+// takes upstreams that don't answer with a 2xx or 3xx out of rotation
+func (p *Pool) StartHealthChecks(path string, interval, timeout time.Duration) {
+	p.client.Timeout = timeout
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			p.checkAll(path)
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (p *Pool) checkAll(path string) {
+	var wg sync.WaitGroup
+	for _, u := range p.upstreams {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			u.healthy.Store(p.check(u, path))
+		}()
+	}
+	wg.Wait()
+}
+
+func (p *Pool) check(u *Upstream, path string) bool {
+	res, err := p.client.Get(u.URL + path)
+	if err != nil {
+		return false
+	}
+	res.Body.Close()
+	return res.StatusCode >= 200 && res.StatusCode < 400
+}
+
+func (p *Pool) Close() {
+	p.stopOnce.Do(func() { close(p.stop) })
+}
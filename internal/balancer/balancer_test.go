@@ -0,0 +1,142 @@
+package balancer
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"boot.httpserver/internal/clientkey"
+	"boot.httpserver/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundRobin(t *testing.T) {
+	pool, err := NewPool(NewRoundRobin(), "http://a", "http://b", "http://c")
+	require.NoError(t, err)
+
+	req := testutil.NewRemoteRequest("10.0.0.1:1234", nil)
+	var picked []string
+	for i := 0; i < 4; i++ {
+		u, err := pool.Pick(req)
+		require.NoError(t, err)
+		picked = append(picked, u.URL)
+		pool.Done(u, nil)
+	}
+	assert.Equal(t, []string{"http://a", "http://b", "http://c", "http://a"}, picked)
+
+	// Test: unavailable upstreams are skipped
+	pool.Upstreams()[1].healthy.Store(false)
+	for i := 0; i < 6; i++ {
+		u, err := pool.Pick(req)
+		require.NoError(t, err)
+		assert.NotEqual(t, "http://b", u.URL)
+		pool.Done(u, nil)
+	}
+}
+
+func TestLeastConnections(t *testing.T) {
+	pool, err := NewPool(NewLeastConnections(), "http://a", "http://b")
+	require.NoError(t, err)
+
+	req := testutil.NewRemoteRequest("10.0.0.1:1234", nil)
+	first, err := pool.Pick(req)
+	require.NoError(t, err)
+	second, err := pool.Pick(req)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.URL, second.URL)
+
+	pool.Done(second, nil)
+	third, err := pool.Pick(req)
+	require.NoError(t, err)
+	assert.Equal(t, second.URL, third.URL)
+	assert.Equal(t, int64(1), first.ActiveConnections())
+}
+
+func TestConsistentHash(t *testing.T) {
+	pool, err := NewPool(NewConsistentHash(0), "http://a", "http://b", "http://c")
+	require.NoError(t, err)
+	pool.Key = clientkey.Header("X-User")
+
+	owners := map[string]string{}
+	for _, user := range []string{"alice", "bob", "carol", "dave", "erin", "frank"} {
+		req := testutil.NewRemoteRequest("", map[string]string{"x-user": user})
+		u, err := pool.Pick(req)
+		require.NoError(t, err)
+		owners[user] = u.URL
+
+		again, err := pool.Pick(req)
+		require.NoError(t, err)
+		assert.Equal(t, u.URL, again.URL)
+	}
+
+	// Test: ejecting an upstream only moves the keys it owned
+	ejected := pool.Upstreams()[0]
+	ejected.healthy.Store(false)
+	for user, owner := range owners {
+		u, err := pool.Pick(testutil.NewRemoteRequest("", map[string]string{"x-user": user}))
+		require.NoError(t, err)
+		assert.NotEqual(t, ejected.URL, u.URL)
+		if owner != ejected.URL {
+			assert.Equal(t, owner, u.URL)
+		}
+	}
+
+	// Test: client IP key ignores the port
+	pool.Key = clientkey.RemoteIP
+	a, err := pool.Pick(testutil.NewRemoteRequest("192.168.1.7:5000", nil))
+	require.NoError(t, err)
+	b, err := pool.Pick(testutil.NewRemoteRequest("192.168.1.7:6000", nil))
+	require.NoError(t, err)
+	assert.Equal(t, a.URL, b.URL)
+}
+
+func TestPassiveEjection(t *testing.T) {
+	pool, err := NewPool(NewRoundRobin(), "http://a")
+	require.NoError(t, err)
+	pool.MaxFails = 2
+	pool.EjectFor = time.Hour
+
+	req := testutil.NewRemoteRequest("10.0.0.1:1234", nil)
+	u, err := pool.Pick(req)
+	require.NoError(t, err)
+	pool.Done(u, errors.New("boom"))
+	assert.True(t, u.Available())
+
+	// Test: releasing an upstream that was never contacted keeps its count
+	u, err = pool.Pick(req)
+	require.NoError(t, err)
+	pool.Release(u)
+	assert.Equal(t, int64(0), u.ActiveConnections())
+	assert.Equal(t, 1, u.failures)
+	assert.True(t, u.ejectedUntil.IsZero())
+	assert.True(t, u.Available())
+
+	u, err = pool.Pick(req)
+	require.NoError(t, err)
+	pool.Done(u, errors.New("boom"))
+	assert.False(t, u.Available())
+
+	_, err = pool.Pick(req)
+	assert.ErrorIs(t, err, ErrNoUpstream)
+}
+
+func TestHealthChecks(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer up.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	pool, err := NewPool(NewRoundRobin(), up.URL, down.URL)
+	require.NoError(t, err)
+	pool.checkAll("/health")
+
+	assert.True(t, pool.Upstreams()[0].Available())
+	assert.False(t, pool.Upstreams()[1].Available())
+}
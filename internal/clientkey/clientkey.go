@@ -0,0 +1,86 @@
+// Package clientkey derives the key a request is grouped under, for
+// rate limiting buckets or consistent hashing
+package clientkey
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+
+	"boot.httpserver/internal/request"
+)
+
+type Func func(req *request.Request) string
+
+func Header(name string) Func {
+	return func(req *request.Request) string {
+		value, _ := req.Headers.Get(name)
+		return value
+	}
+}
+
+// RemoteIP is the peer address without its port
+func RemoteIP(req *request.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// ClientIP keys requests by client address. X-Forwarded-For is only
+// believed when the connection comes from one of the trusted proxies,
+// given as addresses or CIDR prefixes, and then only up to the first
+// address that isn't itself a trusted proxy
+func ClientIP(trustedProxies ...string) (Func, error) {
+	var trusted []netip.Prefix
+	for _, proxy := range trustedProxies {
+		if prefix, err := netip.ParsePrefix(proxy); err == nil {
+			trusted = append(trusted, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", proxy)
+		}
+		trusted = append(trusted, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	if len(trusted) == 0 {
+		return RemoteIP, nil
+	}
+	isTrusted := func(ip string) bool {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			return false
+		}
+		addr = addr.Unmap()
+		for _, prefix := range trusted {
+			if prefix.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(req *request.Request) string {
+		client := RemoteIP(req)
+		if !isTrusted(client) {
+			return client
+		}
+		forwarded, _ := req.Headers.Get("X-Forwarded-For")
+		hops := strings.Split(forwarded, ",")
+		// proxies append, so walk back from the one closest to us
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if hop == "" {
+				continue
+			}
+			client = hop
+			if !isTrusted(hop) {
+				break
+			}
+		}
+		return client
+	}, nil
+}
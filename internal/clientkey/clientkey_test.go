@@ -0,0 +1,40 @@
+package clientkey
+
+import (
+	"testing"
+
+	"boot.httpserver/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeaderAndRemoteIP(t *testing.T) {
+	req := testutil.NewRemoteRequest("192.168.1.7:5000", nil)
+	req.Headers.Set("X-User", "alice")
+	assert.Equal(t, "alice", Header("x-user")(req))
+	assert.Equal(t, "192.168.1.7", RemoteIP(req))
+	assert.Equal(t, "::1", RemoteIP(testutil.NewRemoteRequest("[::1]:5000", nil)))
+	// Test: an address without a port is used as is
+	assert.Equal(t, "pipe", RemoteIP(testutil.NewRemoteRequest("pipe", nil)))
+}
+
+func TestClientIP(t *testing.T) {
+	key, err := ClientIP("10.0.0.0/8", "192.168.1.1")
+	require.NoError(t, err)
+
+	// Test: untrusted peers can't spoof their address
+	assert.Equal(t, "203.0.113.9", key(testutil.NewRemoteRequest("203.0.113.9:5000", map[string]string{"x-forwarded-for": "1.2.3.4"})))
+	// Test: the first untrusted hop from the right is the client
+	assert.Equal(t, "198.51.100.7", key(testutil.NewRemoteRequest("10.1.2.3:5000", map[string]string{"x-forwarded-for": "1.2.3.4, 198.51.100.7, 10.0.0.2"})))
+	assert.Equal(t, "198.51.100.7", key(testutil.NewRemoteRequest("192.168.1.1:5000", map[string]string{"x-forwarded-for": "198.51.100.7"})))
+	// Test: a trusted proxy without the header is the client
+	assert.Equal(t, "10.1.2.3", key(testutil.NewRemoteRequest("10.1.2.3:5000", nil)))
+
+	// Test: without trusted proxies the header is never read
+	key, err = ClientIP()
+	require.NoError(t, err)
+	assert.Equal(t, "10.1.2.3", key(testutil.NewRemoteRequest("10.1.2.3:5000", map[string]string{"x-forwarded-for": "198.51.100.7"})))
+
+	_, err = ClientIP("not-an-ip")
+	assert.Error(t, err)
+}
@@ -0,0 +1,140 @@
+package debug
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"strconv"
+	"strings"
+	"time"
+
+	"boot.httpserver/internal/request"
+	"boot.httpserver/internal/response"
+	"boot.httpserver/internal/server"
+)
+
+const prefix = "/debug/pprof/"
+
+// longest CPU profile or execution trace we'll record for one request
+const maxProfileDuration = 5 * time.Minute
+
+// NewMux serves runtime profiles under /debug/pprof/ in the format the
+// go tool pprof expects. It exposes internals and can stall the process,
+// so it should only be served on a private port
+func NewMux() *server.Mux {
+	mux := server.NewMux()
+	mux.Handle("GET", prefix, Index)
+	mux.Handle("GET", prefix+"cmdline", Cmdline)
+	mux.Handle("GET", prefix+"profile", Profile)
+	mux.Handle("GET", prefix+"trace", Trace)
+	return mux
+}
+
+// Index lists the available profiles, or serves the one named in the
+// path such as /debug/pprof/goroutine?debug=2
+func Index(w *response.Writer, req *request.Request) {
+	name := strings.TrimPrefix(req.Path(), prefix)
+	if name != "" {
+		serveProfile(w, req, name)
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("<html>\n<head><title>/debug/pprof/</title></head>\n<body>\n<p>profiles:</p>\n<table>\n")
+	for _, p := range pprof.Profiles() {
+		fmt.Fprintf(&b, "<tr><td>%d</td><td><a href=\"%s?debug=1\">%s</a></td></tr>\n", p.Count(), html.EscapeString(p.Name()), html.EscapeString(p.Name()))
+	}
+	b.WriteString("</table>\n<p><a href=\"goroutine?debug=2\">full goroutine stack dump</a></p>\n")
+	b.WriteString("<p><a href=\"profile?seconds=30\">cpu profile</a> <a href=\"trace?seconds=5\">execution trace</a></p>\n</body>\n</html>\n")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(response.OK)
+	io.WriteString(w, b.String())
+}
+
+func serveProfile(w *response.Writer, req *request.Request, name string) {
+	p := pprof.Lookup(name)
+	if p == nil {
+		server.WriteError(w, req, response.NOTFOUND, "unknown profile "+name)
+		return
+	}
+	debug, _ := strconv.Atoi(req.Query().Get("debug"))
+	if name == "heap" && req.Query().Get("gc") != "" {
+		runtime.GC()
+	}
+	setProfileHeaders(w, debug, name)
+	w.WriteHeader(response.OK)
+	p.WriteTo(w, debug)
+}
+
+func setProfileHeaders(w *response.Writer, debug int, name string) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if debug > 0 {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+}
+
+func Cmdline(w *response.Writer, req *request.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(response.OK)
+	io.WriteString(w, strings.Join(os.Args, "\x00"))
+}
+
+// Profile records a CPU profile for ?seconds, 30 by default
+func Profile(w *response.Writer, req *request.Request) {
+	d, ok := duration(w, req, 30*time.Second)
+	if !ok {
+		return
+	}
+	// write into memory first so a failure can still become an error response
+	var buf strings.Builder
+	if err := pprof.StartCPUProfile(&buf); err != nil {
+		server.WriteError(w, req, response.INTERNALERROR, "could not enable CPU profiling: "+err.Error())
+		return
+	}
+	time.Sleep(d)
+	pprof.StopCPUProfile()
+
+	setProfileHeaders(w, 0, "profile")
+	w.WriteHeader(response.OK)
+	io.WriteString(w, buf.String())
+}
+
+// Trace records an execution trace for ?seconds, 1 by default
+func Trace(w *response.Writer, req *request.Request) {
+	d, ok := duration(w, req, time.Second)
+	if !ok {
+		return
+	}
+	var buf strings.Builder
+	if err := trace.Start(&buf); err != nil {
+		server.WriteError(w, req, response.INTERNALERROR, "could not enable tracing: "+err.Error())
+		return
+	}
+	time.Sleep(d)
+	trace.Stop()
+
+	setProfileHeaders(w, 0, "trace")
+	w.WriteHeader(response.OK)
+	io.WriteString(w, buf.String())
+}
+
+func duration(w *response.Writer, req *request.Request, fallback time.Duration) (time.Duration, bool) {
+	value := req.Query().Get("seconds")
+	if value == "" {
+		return fallback, true
+	}
+	seconds, err := strconv.ParseFloat(value, 64)
+	d := time.Duration(seconds * float64(time.Second))
+	if err != nil || d <= 0 || d > maxProfileDuration {
+		server.WriteError(w, req, response.BADREQUEST, "seconds must be a positive number up to "+strconv.Itoa(int(maxProfileDuration.Seconds())))
+		return 0, false
+	}
+	return d, true
+}
@@ -0,0 +1,42 @@
+package debug
+
+import (
+	"testing"
+
+	"boot.httpserver/internal/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndex(t *testing.T) {
+	out := testutil.Serve(NewMux().ServeRequest, testutil.NewRequest("GET", "/debug/pprof/", nil))
+	assert.Contains(t, out, "HTTP/1.1 200 OK\r\n")
+	assert.Contains(t, out, `<a href="goroutine?debug=1">goroutine</a>`)
+	assert.Contains(t, out, `<a href="heap?debug=1">heap</a>`)
+}
+
+func TestProfiles(t *testing.T) {
+	// Test: goroutine dump in text
+	out := testutil.Serve(NewMux().ServeRequest, testutil.NewRequest("GET", "/debug/pprof/goroutine?debug=2", nil))
+	assert.Contains(t, out, "Content-Type: text/plain; charset=utf-8\r\n")
+	assert.Contains(t, out, "goroutine ")
+	assert.Contains(t, out, "TestProfiles")
+
+	// Test: binary profiles are downloads
+	out = testutil.Serve(NewMux().ServeRequest, testutil.NewRequest("GET", "/debug/pprof/heap", nil))
+	assert.Contains(t, out, "Content-Type: application/octet-stream\r\n")
+	assert.Contains(t, out, `Content-Disposition: attachment; filename="heap"`)
+
+	assert.Contains(t, testutil.Serve(NewMux().ServeRequest, testutil.NewRequest("GET", "/debug/pprof/nope", nil)), "HTTP/1.1 404 Not Found\r\n")
+}
+
+func TestTimedProfiles(t *testing.T) {
+	assert.Contains(t, testutil.Serve(NewMux().ServeRequest, testutil.NewRequest("GET", "/debug/pprof/profile?seconds=-1", nil)), "HTTP/1.1 400 Bad Request\r\n")
+	assert.Contains(t, testutil.Serve(NewMux().ServeRequest, testutil.NewRequest("GET", "/debug/pprof/trace?seconds=forever", nil)), "HTTP/1.1 400 Bad Request\r\n")
+
+	out := testutil.Serve(NewMux().ServeRequest, testutil.NewRequest("GET", "/debug/pprof/profile?seconds=0.05", nil))
+	assert.Contains(t, out, "HTTP/1.1 200 OK\r\n")
+	assert.Contains(t, out, `filename="profile"`)
+	out = testutil.Serve(NewMux().ServeRequest, testutil.NewRequest("GET", "/debug/pprof/trace?seconds=0.05", nil))
+	assert.Contains(t, out, "HTTP/1.1 200 OK\r\n")
+	assert.Contains(t, out, "go 1.")
+}
@@ -0,0 +1,414 @@
+package fileserver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"boot.httpserver/internal/headers"
+	"boot.httpserver/internal/request"
+	"boot.httpserver/internal/response"
+	"boot.httpserver/internal/server"
+)
+
+const (
+	indexPage  = "index.html"
+	sniffLen   = 512
+	bufferSize = 32 * 1024
+)
+
+type FileServer struct {
+	// render an HTML listing for directories without an index.html
+	ListDirectories bool
+
+	prefix string
+	root   string
+}
+
+// New serves the files under root for request targets starting with
+// prefix, e.g. New("/static/", "assets") maps /static/a.css to assets/a.css
+func New(prefix, root string) *FileServer {
+	return &FileServer{
+		prefix: "/" + strings.Trim(prefix, "/"),
+		root:   root,
+	}
+}
+
+func (fsrv *FileServer) Handle(w *response.Writer, req *request.Request) {
+	if !allowedMethod(w, req) {
+		return
+	}
+
+	urlPath, err := cleanPath(req.Path())
+	if err != nil {
+		server.WriteError(w, req, response.BADREQUEST, "invalid path")
+		return
+	}
+	name, ok := strings.CutPrefix(urlPath, fsrv.prefix)
+	if !ok || (name != "" && name[0] != '/' && fsrv.prefix != "/") {
+		server.WriteError(w, req, response.NOTFOUND, "not found")
+		return
+	}
+
+	// os.Root refuses to resolve anything (.. or symlinks) outside root
+	root, err := os.OpenRoot(fsrv.root)
+	if err != nil {
+		log.Printf("error opening root %s: %v", fsrv.root, err)
+		server.WriteError(w, req, response.INTERNALERROR, "internal error")
+		return
+	}
+	defer root.Close()
+
+	name = strings.TrimPrefix(name, "/")
+	if name == "" {
+		name = "."
+	}
+
+	f, info, ok := open(w, req, root, name)
+	if !ok {
+		return
+	}
+	defer f.Close()
+
+	if info.IsDir() {
+		if !strings.HasSuffix(urlPath, "/") {
+			redirect(w, urlPath+"/")
+			return
+		}
+		index, indexInfo, err := openFile(root, path.Join(name, indexPage))
+		if err == nil {
+			defer index.Close()
+			ServeContent(w, req, indexPage, indexInfo.ModTime(), index)
+			return
+		}
+		if !fsrv.ListDirectories {
+			server.WriteError(w, req, response.FORBIDDEN, "directory listing not allowed")
+			return
+		}
+		listDirectory(w, req, urlPath, f)
+		return
+	}
+
+	ServeContent(w, req, info.Name(), info.ModTime(), f)
+}
+
+// ServeFile writes the single file at name regardless of the request target
+func ServeFile(w *response.Writer, req *request.Request, name string) {
+	if !allowedMethod(w, req) {
+		return
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		writeOpenError(w, req, err)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		server.WriteError(w, req, response.NOTFOUND, "not found")
+		return
+	}
+	ServeContent(w, req, info.Name(), info.ModTime(), f)
+}
+
+// ServeContent replies with content, which may be any io.ReadSeeker.
+// Range requests are answered with 206 Partial Content, as a
+// multipart/byteranges body when several ranges are asked for
+func ServeContent(w *response.Writer, req *request.Request, name string, modtime time.Time, content io.ReadSeeker) {
+	size, err := content.Seek(0, io.SeekEnd)
+	if err == nil {
+		_, err = content.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		log.Printf("error seeking %s: %v", name, err)
+		server.WriteError(w, req, response.INTERNALERROR, "internal error")
+		return
+	}
+
+	etag := ""
+	if !modtime.IsZero() {
+		etag = response.ModTimeETag(modtime, size)
+	}
+	if status := response.EvaluatePreconditions(req, etag, modtime); status != response.OK {
+		response.WritePreconditionResult(w, status, etag, modtime)
+		return
+	}
+
+	contentType, err := detectContentType(name, content)
+	if err != nil {
+		log.Printf("error sniffing %s: %v", name, err)
+		server.WriteError(w, req, response.INTERNALERROR, "internal error")
+		return
+	}
+
+	h := response.GetDefaultHeaders(0)
+	h.Set("Accept-Ranges", "bytes")
+	h.Set("Content-Type", contentType)
+	if etag != "" {
+		h.Set("ETag", etag)
+		h.Set("Last-Modified", modtime.UTC().Format(http.TimeFormat))
+	}
+
+	rangeHeader, _ := req.Headers.Get("Range")
+	if !checkIfRange(req, etag, modtime) {
+		rangeHeader = ""
+	}
+	ranges, err := ParseRange(rangeHeader, size)
+	if errors.Is(err, errUnsatisfiable) {
+		body := []byte("range not satisfiable")
+		h.Set("Content-Length", strconv.Itoa(len(body)))
+		h.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		w.WriteStatusLine(response.RANGENOTSATISFIABLE)
+		w.WriteHeaders(h)
+		w.WriteBody(body)
+		return
+	}
+	// a malformed Range header is ignored, as is one asking for more
+	// bytes than a plain 200 would send
+	if err != nil || sumRangesSize(ranges) > size {
+		ranges = nil
+	}
+
+	switch len(ranges) {
+	case 0:
+		h.Set("Content-Length", strconv.FormatInt(size, 10))
+		w.WriteStatusLine(response.OK)
+		w.WriteHeaders(h)
+		if req.RequestLine.Method == "HEAD" {
+			return
+		}
+		err = copyBody(w, content)
+	case 1:
+		r := ranges[0]
+		h.Set("Content-Length", strconv.FormatInt(r.Length, 10))
+		h.Set("Content-Range", r.ContentRange(size))
+		w.WriteStatusLine(response.PARTIALCONTENT)
+		w.WriteHeaders(h)
+		if req.RequestLine.Method == "HEAD" {
+			return
+		}
+		err = copyRange(w, content, r)
+	default:
+		err = writeMultipartRanges(w, req, h, contentType, size, ranges, content)
+	}
+	if err != nil {
+		log.Printf("error serving %s: %v", name, err)
+	}
+}
+
+func writeMultipartRanges(w *response.Writer, req *request.Request, h headers.Headers, contentType string, size int64, ranges []ByteRange, content io.ReadSeeker) error {
+	boundary := randomBoundary()
+	parts := make([]string, len(ranges))
+	for i, r := range ranges {
+		if i > 0 {
+			parts[i] = "\r\n"
+		}
+		parts[i] += "--" + boundary + "\r\n" +
+			"Content-Type: " + contentType + "\r\n" +
+			"Content-Range: " + r.ContentRange(size) + "\r\n\r\n"
+	}
+	closing := "\r\n--" + boundary + "--\r\n"
+
+	length := int64(len(closing))
+	for i, r := range ranges {
+		length += int64(len(parts[i])) + r.Length
+	}
+
+	h.Set("Content-Length", strconv.FormatInt(length, 10))
+	h.Set("Content-Type", "multipart/byteranges; boundary="+boundary)
+	w.WriteStatusLine(response.PARTIALCONTENT)
+	w.WriteHeaders(h)
+	if req.RequestLine.Method == "HEAD" {
+		return nil
+	}
+
+	for i, r := range ranges {
+		if _, err := w.WriteBody([]byte(parts[i])); err != nil {
+			return err
+		}
+		if err := copyRange(w, content, r); err != nil {
+			return err
+		}
+	}
+	_, err := w.WriteBody([]byte(closing))
+	return err
+}
+
+func copyRange(w *response.Writer, content io.ReadSeeker, r ByteRange) error {
+	if _, err := content.Seek(r.Start, io.SeekStart); err != nil {
+		return err
+	}
+	return copyBody(w, io.LimitReader(content, r.Length))
+}
+
+// checkIfRange reports whether a Range header may be honoured. An
+// If-Range entity tag must strongly match the ETag and a date must match
+// Last-Modified exactly
+func checkIfRange(req *request.Request, etag string, modtime time.Time) bool {
+	value, exists := req.Headers.Get("If-Range")
+	if !exists {
+		return true
+	}
+	if strings.HasPrefix(value, "\"") || strings.HasPrefix(value, "W/") {
+		return response.StrongMatch(etag, value)
+	}
+	t, err := http.ParseTime(value)
+	if err != nil || modtime.IsZero() {
+		return false
+	}
+	return modtime.Truncate(time.Second).Equal(t)
+}
+
+func randomBoundary() string {
+	var buf [16]byte
+	rand.Read(buf[:])
+	return hex.EncodeToString(buf[:])
+}
+
+func detectContentType(name string, content io.ReadSeeker) (string, error) {
+	if contentType := mime.TypeByExtension(filepath.Ext(name)); contentType != "" {
+		return contentType, nil
+	}
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(content, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
+
+func copyBody(w *response.Writer, r io.Reader) error {
+	buf := make([]byte, bufferSize)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if _, werr := w.WriteBody(buf[:n]); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func listDirectory(w *response.Writer, req *request.Request, urlPath string, dir fs.ReadDirFile) {
+	entries, err := dir.ReadDir(-1)
+	if err != nil {
+		log.Printf("error reading directory %s: %v", urlPath, err)
+		server.WriteError(w, req, response.INTERNALERROR, "internal error")
+		return
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+
+	var b strings.Builder
+	title := html.EscapeString(urlPath)
+	fmt.Fprintf(&b, "<html>\n  <head>\n    <title>Index of %s</title>\n  </head>\n  <body>\n    <h1>Index of %s</h1>\n    <ul>\n", title, title)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			name += "/"
+		}
+		link := url.URL{Path: name}
+		fmt.Fprintf(&b, "      <li><a href=\"%s\">%s</a></li>\n", link.String(), html.EscapeString(name))
+	}
+	b.WriteString("    </ul>\n  </body>\n</html>\r\n")
+
+	body := []byte(b.String())
+	h := response.GetDefaultHeaders(len(body))
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteStatusLine(response.OK)
+	w.WriteHeaders(h)
+	if req.RequestLine.Method == "HEAD" {
+		return
+	}
+	w.WriteBody(body)
+}
+
+func open(w *response.Writer, req *request.Request, root *os.Root, name string) (*os.File, fs.FileInfo, bool) {
+	f, info, err := openFile(root, name)
+	if err != nil {
+		writeOpenError(w, req, err)
+		return nil, nil, false
+	}
+	return f, info, true
+}
+
+func openFile(root *os.Root, name string) (*os.File, fs.FileInfo, error) {
+	f, err := root.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, info, nil
+}
+
+func writeOpenError(w *response.Writer, req *request.Request, err error) {
+	if errors.Is(err, fs.ErrPermission) {
+		server.WriteError(w, req, response.FORBIDDEN, "forbidden")
+		return
+	}
+	// missing files and paths escaping the root both look like a 404
+	server.WriteError(w, req, response.NOTFOUND, "not found")
+}
+
+// cleanPath decodes the request path and resolves any dot
+// segments, keeping a trailing slash so directories can be told apart
+func cleanPath(target string) (string, error) {
+	decoded, err := url.PathUnescape(target)
+	if err != nil {
+		return "", err
+	}
+	if strings.ContainsRune(decoded, 0) {
+		return "", errors.New("path contains NUL")
+	}
+	cleaned := path.Clean("/" + decoded)
+	if strings.HasSuffix(decoded, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned, nil
+}
+
+func allowedMethod(w *response.Writer, req *request.Request) bool {
+	method := req.RequestLine.Method
+	if method == "GET" || method == "HEAD" {
+		return true
+	}
+	w.Header().Set("Allow", "GET, HEAD")
+	server.WriteError(w, req, response.METHODNOTALLOWED, "method not allowed")
+	return false
+}
+
+func redirect(w *response.Writer, location string) {
+	h := response.GetDefaultHeaders(0)
+	h.Set("Location", location)
+	w.WriteStatusLine(response.MOVEDPERMANENTLY)
+	w.WriteHeaders(h)
+}
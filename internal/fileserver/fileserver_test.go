@@ -0,0 +1,95 @@
+package fileserver
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"boot.httpserver/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRoot(t *testing.T) string {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "hello.txt"), []byte("hello world"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "noext"), []byte("<html><body>hi</body></html>"), 0o644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "site"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "site", "index.html"), []byte("<h1>index</h1>"), 0o644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "docs"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "docs", "a <b>.txt"), []byte("a"), 0o644))
+	return dir
+}
+
+func TestServeFile(t *testing.T) {
+	fs := New("/static/", newRoot(t))
+
+	// Test: content type from extension and length from stat
+	out := testutil.Serve(fs.Handle, testutil.NewRequest("GET", "/static/hello.txt?v=1", nil))
+	assert.Contains(t, out, "HTTP/1.1 200 OK\r\n")
+	assert.Contains(t, out, "Content-Type: text/plain; charset=utf-8\r\n")
+	assert.Contains(t, out, "Content-Length: 11\r\n")
+	assert.Contains(t, out, "Last-Modified: ")
+	assert.True(t, bytes.HasSuffix([]byte(out), []byte("\r\n\r\nhello world")))
+
+	// Test: content type sniffed when there is no extension
+	out = testutil.Serve(fs.Handle, testutil.NewRequest("GET", "/static/noext", nil))
+	assert.Contains(t, out, "Content-Type: text/html; charset=utf-8\r\n")
+	assert.Contains(t, out, "<html><body>hi</body></html>")
+
+	// Test: HEAD sends headers only
+	out = testutil.Serve(fs.Handle, testutil.NewRequest("HEAD", "/static/hello.txt", nil))
+	assert.Contains(t, out, "Content-Length: 11\r\n")
+	assert.NotContains(t, out, "hello world")
+
+	// Test: unsupported method
+	out = testutil.Serve(fs.Handle, testutil.NewRequest("POST", "/static/hello.txt", nil))
+	assert.Contains(t, out, "HTTP/1.1 405 Method Not Allowed\r\n")
+	assert.Contains(t, out, "Allow: GET, HEAD\r\n")
+
+	// Test: missing file
+	out = testutil.Serve(fs.Handle, testutil.NewRequest("GET", "/static/missing.txt", nil))
+	assert.Contains(t, out, "HTTP/1.1 404 Not Found\r\n")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\nnot found"))
+}
+
+func TestPathTraversal(t *testing.T) {
+	parent := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(parent, "secret"), []byte("secret"), 0o644))
+	root := filepath.Join(parent, "root")
+	require.NoError(t, os.Mkdir(root, 0o755))
+	require.NoError(t, os.Symlink(filepath.Join(parent, "secret"), filepath.Join(root, "link")))
+	fs := New("/", root)
+
+	for _, target := range []string{"/../secret", "/%2e%2e/secret", "/..%2fsecret", "/link"} {
+		out := testutil.Serve(fs.Handle, testutil.NewRequest("GET", target, nil))
+		assert.NotContains(t, out, "\r\n\r\nsecret", target)
+		assert.NotContains(t, out, "200 OK", target)
+	}
+}
+
+func TestDirectories(t *testing.T) {
+	fs := New("/", newRoot(t))
+
+	// Test: directories without a trailing slash are redirected
+	out := testutil.Serve(fs.Handle, testutil.NewRequest("GET", "/site", nil))
+	assert.Contains(t, out, "HTTP/1.1 301 Moved Permanently\r\n")
+	assert.Contains(t, out, "Location: /site/\r\n")
+
+	// Test: index.html is served for the directory
+	out = testutil.Serve(fs.Handle, testutil.NewRequest("GET", "/site/", nil))
+	assert.Contains(t, out, "Content-Type: text/html; charset=utf-8\r\n")
+	assert.Contains(t, out, "<h1>index</h1>")
+
+	// Test: listings are off by default
+	out = testutil.Serve(fs.Handle, testutil.NewRequest("GET", "/docs/", nil))
+	assert.Contains(t, out, "HTTP/1.1 403 Forbidden\r\n")
+
+	// Test: listings escape file names
+	fs.ListDirectories = true
+	out = testutil.Serve(fs.Handle, testutil.NewRequest("GET", "/docs/", nil))
+	assert.Contains(t, out, "HTTP/1.1 200 OK\r\n")
+	assert.Contains(t, out, `<a href="a%20%3Cb%3E.txt">a &lt;b&gt;.txt</a>`)
+}
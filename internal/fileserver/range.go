@@ -0,0 +1,105 @@
+package fileserver
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var errUnsatisfiable = errors.New("range not satisfiable")
+
+// more ranges than this are answered with the whole content; each one
+// costs a seek and a part header, and real clients ask for a handful
+const maxRanges = 100
+
+type ByteRange struct {
+	Start  int64
+	Length int64
+}
+
+func (r ByteRange) ContentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.Start+r.Length-1, size)
+}
+
+// ParseRange parses a Range header value against a representation of
+// size bytes. Ranges starting past the end are dropped; if none are left
+// the error is errUnsatisfiable. A nil result means the whole content,
+// which is also what a header without any ranges in it asks for
+func ParseRange(s string, size int64) ([]ByteRange, error) {
+	if s == "" {
+		return nil, nil
+	}
+	spec, ok := strings.CutPrefix(s, "bytes=")
+	if !ok {
+		return nil, errors.New("invalid range unit")
+	}
+
+	var parts []string
+	for _, part := range strings.Split(spec, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return nil, nil
+	}
+	if len(parts) > maxRanges {
+		return nil, errors.New("too many ranges")
+	}
+
+	var ranges []ByteRange
+	for _, part := range parts {
+		first, last, ok := strings.Cut(part, "-")
+		if !ok {
+			return nil, errors.New("invalid range")
+		}
+		first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+
+		var r ByteRange
+		if first == "" {
+			// suffix range: the final n bytes
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, errors.New("invalid range")
+			}
+			// nothing to take the final bytes of
+			if n == 0 || size == 0 {
+				continue
+			}
+			n = min(n, size)
+			r = ByteRange{Start: size - n, Length: n}
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 {
+				return nil, errors.New("invalid range")
+			}
+			end := size - 1
+			if last != "" {
+				end, err = strconv.ParseInt(last, 10, 64)
+				if err != nil || end < start {
+					return nil, errors.New("invalid range")
+				}
+				end = min(end, size-1)
+			}
+			if start >= size {
+				continue
+			}
+			r = ByteRange{Start: start, Length: end - start + 1}
+		}
+		ranges = append(ranges, r)
+	}
+
+	if len(ranges) == 0 {
+		return nil, errUnsatisfiable
+	}
+	return ranges, nil
+}
+
+func sumRangesSize(ranges []ByteRange) int64 {
+	var size int64
+	for _, r := range ranges {
+		size += r.Length
+	}
+	return size
+}
@@ -0,0 +1,185 @@
+package fileserver
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"boot.httpserver/internal/request"
+	"boot.httpserver/internal/response"
+	"boot.httpserver/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRange(t *testing.T) {
+	// Test: no header means the whole content
+	ranges, err := ParseRange("", 100)
+	require.NoError(t, err)
+	assert.Nil(t, ranges)
+
+	// Test: a set without any ranges is no Range header either
+	for _, s := range []string{"bytes=", "bytes=,", "bytes= , "} {
+		ranges, err = ParseRange(s, 100)
+		require.NoError(t, err, s)
+		assert.Nil(t, ranges, s)
+	}
+
+	// Test: closed, open ended and suffix ranges
+	ranges, err = ParseRange("bytes=0-9, 90-, -5", 100)
+	require.NoError(t, err)
+	assert.Equal(t, []ByteRange{{0, 10}, {90, 10}, {95, 5}}, ranges)
+
+	// Test: end past the size is clamped
+	ranges, err = ParseRange("bytes=50-500", 100)
+	require.NoError(t, err)
+	assert.Equal(t, []ByteRange{{50, 50}}, ranges)
+
+	// Test: suffix longer than the content
+	ranges, err = ParseRange("bytes=-500", 100)
+	require.NoError(t, err)
+	assert.Equal(t, []ByteRange{{0, 100}}, ranges)
+
+	// Test: unsatisfiable ranges are dropped
+	ranges, err = ParseRange("bytes=200-300, 0-0", 100)
+	require.NoError(t, err)
+	assert.Equal(t, []ByteRange{{0, 1}}, ranges)
+
+	_, err = ParseRange("bytes=200-300", 100)
+	assert.ErrorIs(t, err, errUnsatisfiable)
+
+	// Test: an empty representation has no suffix to serve
+	_, err = ParseRange("bytes=-5", 0)
+	assert.ErrorIs(t, err, errUnsatisfiable)
+
+	// Test: malformed ranges
+	for _, s := range []string{"items=0-1", "bytes=a-b", "bytes=5-1", "bytes=1"} {
+		_, err = ParseRange(s, 100)
+		assert.Error(t, err, s)
+		assert.NotErrorIs(t, err, errUnsatisfiable, s)
+	}
+
+	// Test: too many ranges
+	many := "bytes=" + strings.Repeat("0-0,", maxRanges) + "0-0"
+	_, err = ParseRange(many, 100)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, errUnsatisfiable)
+}
+
+func serveContent(h map[string]string, content string, modtime time.Time) string {
+	return testutil.Serve(func(w *response.Writer, req *request.Request) {
+		ServeContent(w, req, "data.txt", modtime, strings.NewReader(content))
+	}, testutil.NewRequest("GET", "/", h))
+}
+
+func TestServeContentRanges(t *testing.T) {
+	content := "0123456789abcdefghij"
+	modtime := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// Test: full response advertises range support
+	out := serveContent(nil, content, modtime)
+	assert.Contains(t, out, "HTTP/1.1 200 OK\r\n")
+	assert.Contains(t, out, "Accept-Ranges: bytes\r\n")
+
+	// Test: single range
+	out = serveContent(map[string]string{"range": "bytes=2-5"}, content, modtime)
+	assert.Contains(t, out, "HTTP/1.1 206 Partial Content\r\n")
+	assert.Contains(t, out, "Content-Range: bytes 2-5/20\r\n")
+	assert.Contains(t, out, "Content-Length: 4\r\n")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\n2345"))
+
+	// Test: unsatisfiable range
+	out = serveContent(map[string]string{"range": "bytes=30-"}, content, modtime)
+	assert.Contains(t, out, "HTTP/1.1 416 Range Not Satisfiable\r\n")
+	assert.Contains(t, out, "Content-Range: bytes */20\r\n")
+
+	// Test: a suffix range of an empty file
+	out = serveContent(map[string]string{"range": "bytes=-5"}, "", modtime)
+	assert.Contains(t, out, "HTTP/1.1 416 Range Not Satisfiable\r\n")
+	assert.Contains(t, out, "Content-Range: bytes */0\r\n")
+
+	// Test: malformed range is ignored
+	out = serveContent(map[string]string{"range": "bytes=x"}, content, modtime)
+	assert.Contains(t, out, "HTTP/1.1 200 OK\r\n")
+
+	// Test: so are an empty range set and too many ranges
+	out = serveContent(map[string]string{"range": "bytes=,"}, content, modtime)
+	assert.Contains(t, out, "HTTP/1.1 200 OK\r\n")
+	out = serveContent(map[string]string{"range": "bytes=" + strings.Repeat("0-0,", maxRanges+1)}, content, modtime)
+	assert.Contains(t, out, "HTTP/1.1 200 OK\r\n")
+	assert.True(t, strings.HasSuffix(out, content))
+
+	// Test: If-Range matching Last-Modified keeps the range
+	lastModified := modtime.Format(http.TimeFormat)
+	out = serveContent(map[string]string{"range": "bytes=0-0", "if-range": lastModified}, content, modtime)
+	assert.Contains(t, out, "HTTP/1.1 206 Partial Content\r\n")
+
+	// Test: stale If-Range gets the full content
+	stale := modtime.Add(-time.Hour).Format(http.TimeFormat)
+	out = serveContent(map[string]string{"range": "bytes=0-0", "if-range": stale}, content, modtime)
+	assert.Contains(t, out, "HTTP/1.1 200 OK\r\n")
+	assert.True(t, strings.HasSuffix(out, content))
+}
+
+func TestServeContentMultipart(t *testing.T) {
+	content := "0123456789abcdefghij"
+	out := serveContent(map[string]string{"range": "bytes=0-1, 10-12"}, content, time.Time{})
+	assert.Contains(t, out, "HTTP/1.1 206 Partial Content\r\n")
+
+	head, body, ok := strings.Cut(out, "\r\n\r\n")
+	require.True(t, ok)
+
+	var contentType string
+	for _, line := range strings.Split(head, "\r\n") {
+		if v, ok := strings.CutPrefix(line, "Content-Type: "); ok {
+			contentType = v
+		}
+		if v, ok := strings.CutPrefix(line, "Content-Length: "); ok {
+			assert.Equal(t, strconv.Itoa(len(body)), v)
+		}
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/byteranges", mediaType)
+
+	mr := multipart.NewReader(strings.NewReader(body), params["boundary"])
+	var got []string
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(part)
+		require.NoError(t, err)
+		got = append(got, part.Header.Get("Content-Range")+" "+string(data))
+	}
+	assert.Equal(t, []string{"bytes 0-1/20 01", "bytes 10-12/20 abc"}, got)
+}
+
+func TestServeContentConditional(t *testing.T) {
+	content := "0123456789abcdefghij"
+	modtime := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	etag := response.ModTimeETag(modtime, int64(len(content)))
+
+	out := serveContent(nil, content, modtime)
+	assert.Contains(t, out, "ETag: "+etag+"\r\n")
+
+	// Test: matching If-None-Match is answered without a body
+	out = serveContent(map[string]string{"if-none-match": etag}, content, modtime)
+	assert.Contains(t, out, "HTTP/1.1 304 Not Modified\r\n")
+	assert.NotContains(t, out, content)
+
+	// Test: If-Range with the current entity tag keeps the range
+	out = serveContent(map[string]string{"range": "bytes=0-0", "if-range": etag}, content, modtime)
+	assert.Contains(t, out, "HTTP/1.1 206 Partial Content\r\n")
+
+	// Test: If-Range with an old entity tag gets the full content
+	out = serveContent(map[string]string{"range": "bytes=0-0", "if-range": `"old"`}, content, modtime)
+	assert.Contains(t, out, "HTTP/1.1 200 OK\r\n")
+}
@@ -0,0 +1,117 @@
+package headers
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// MediaRange is one entry of an Accept header, such as "text/*;q=0.5".
+// Type and Subtype may be "*"
+type MediaRange struct {
+	Type    string
+	Subtype string
+	Params  map[string]string
+	Q       float64
+}
+
+// Specificity ranks ranges so the most specific one matching a media type
+// decides its quality: */* < type/* < type/subtype < with parameters
+func (m MediaRange) Specificity() int {
+	switch {
+	case m.Type == "*":
+		return 0
+	case m.Subtype == "*":
+		return 1
+	case len(m.Params) == 0:
+		return 2
+	}
+	return 3
+}
+
+// Matches reports whether mediaType, e.g. "text/html;level=1", falls in
+// the range. Every parameter of the range must be present in mediaType
+func (m MediaRange) Matches(mediaType string) bool {
+	t, ok := parseMediaRange(mediaType)
+	if !ok {
+		return false
+	}
+	if m.Type != "*" && m.Type != t.Type {
+		return false
+	}
+	if m.Subtype != "*" && m.Subtype != t.Subtype {
+		return false
+	}
+	for name, value := range m.Params {
+		if t.Params[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseAccept parses an Accept header into media ranges ordered by
+// descending q, more specific ranges first on ties. Malformed entries
+// are dropped
+func ParseAccept(value string) []MediaRange {
+	var ranges []MediaRange
+	for _, part := range strings.Split(value, ",") {
+		if m, ok := parseMediaRange(part); ok {
+			ranges = append(ranges, m)
+		}
+	}
+	slices.SortStableFunc(ranges, func(a, b MediaRange) int {
+		switch {
+		case a.Q > b.Q:
+			return -1
+		case a.Q < b.Q:
+			return 1
+		}
+		return b.Specificity() - a.Specificity()
+	})
+	return ranges
+}
+
+func parseMediaRange(s string) (MediaRange, bool) {
+	mediaType, params, _ := strings.Cut(s, ";")
+	typ, subtype, ok := strings.Cut(strings.ToLower(strings.TrimSpace(mediaType)), "/")
+	if !ok || typ == "" || subtype == "" || (typ == "*" && subtype != "*") {
+		return MediaRange{}, false
+	}
+
+	m := MediaRange{Type: typ, Subtype: subtype, Q: 1}
+	for _, param := range strings.Split(params, ";") {
+		name, v, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if !ok {
+			continue
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		v = strings.Trim(strings.TrimSpace(v), `"`)
+		if name == "q" {
+			q, err := strconv.ParseFloat(v, 64)
+			if err != nil || q < 0 || q > 1 {
+				return MediaRange{}, false
+			}
+			m.Q = q
+			// anything after q is an accept-ext, not a media type parameter
+			break
+		}
+		if m.Params == nil {
+			m.Params = map[string]string{}
+		}
+		m.Params[name] = strings.ToLower(v)
+	}
+	return m, true
+}
+
+// ParseAcceptLanguage parses language ranges such as "en-GB, en;q=0.8, *;q=0.1"
+// ordered by descending q
+func ParseAcceptLanguage(value string) []QualityValue {
+	return ParseQualityValues(value)
+}
+
+// ParseAcceptCharset parses charsets such as "utf-8, iso-8859-1;q=0.5"
+// ordered by descending q
+func ParseAcceptCharset(value string) []QualityValue {
+	return ParseQualityValues(value)
+}
@@ -63,21 +63,35 @@ func (h Headers) Parse(data []byte) (n int, done bool, err error) {
 }
 
 func (h Headers) Get(key string) (string, bool) {
-	key = strings.ToLower(key)
+	lower := strings.ToLower(key)
 
-	_, exists := h[key]
+	if value, exists := h[lower]; exists {
+		return value, true
+	}
 
-	if !exists {
-		return "", false
+	// headers built by handlers keep their original casing
+	for k, value := range h {
+		if strings.EqualFold(k, key) {
+			return value, true
+		}
 	}
 
-	return h[key], true
+	return "", false
 }
 
 func (h Headers) Set(key string, value string) {
+	h.Delete(key)
 	h[key] = value
 }
 
+func (h Headers) Delete(key string) {
+	for k := range h {
+		if strings.EqualFold(k, key) {
+			delete(h, k)
+		}
+	}
+}
+
 func NewHeaders() Headers {
 	return make(Headers)
 }
@@ -63,3 +63,18 @@ func TestHeadersParse(t *testing.T) {
 	assert.Equal(t, "lane-loves-go, prime-loves-zig", headers["set-person"])
 	assert.False(t, done)
 }
+
+func TestParseAccept(t *testing.T) {
+	ranges := ParseAccept(`text/*;q=0.5, text/html;level=1, application/json, */*;q=0.1, bogus, text/plain;q=2`)
+	require.Len(t, ranges, 4)
+	assert.Equal(t, MediaRange{Type: "text", Subtype: "html", Params: map[string]string{"level": "1"}, Q: 1}, ranges[0])
+	assert.Equal(t, "json", ranges[1].Subtype)
+	assert.Equal(t, "*", ranges[2].Subtype)
+	assert.Equal(t, 0.1, ranges[3].Q)
+
+	// Test: parameters must match
+	assert.True(t, ranges[0].Matches("text/html; level=1"))
+	assert.False(t, ranges[0].Matches("text/html"))
+	assert.True(t, ranges[2].Matches("TEXT/Plain"))
+	assert.True(t, ranges[3].Matches("image/png"))
+}
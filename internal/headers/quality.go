@@ -0,0 +1,53 @@
+package headers
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type QualityValue struct {
+	Value string
+	Q     float64
+}
+
+// ParseQualityValues parses a comma separated list such as
+// "gzip;q=1.0, deflate;q=0.5, *;q=0" ordered by descending q. Entries with
+// an unparsable q are dropped; other parameters are ignored
+func ParseQualityValues(value string) []QualityValue {
+	var values []QualityValue
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		token, params, _ := strings.Cut(part, ";")
+		qv := QualityValue{Value: strings.ToLower(strings.TrimSpace(token)), Q: 1}
+		valid := true
+		for _, param := range strings.Split(params, ";") {
+			name, v, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || !strings.EqualFold(strings.TrimSpace(name), "q") {
+				continue
+			}
+			q, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil || q < 0 || q > 1 {
+				valid = false
+				break
+			}
+			qv.Q = q
+		}
+		if valid && qv.Value != "" {
+			values = append(values, qv)
+		}
+	}
+	slices.SortStableFunc(values, func(a, b QualityValue) int {
+		switch {
+		case a.Q > b.Q:
+			return -1
+		case a.Q < b.Q:
+			return 1
+		}
+		return 0
+	})
+	return values
+}
@@ -0,0 +1,90 @@
+package health
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"boot.httpserver/internal/request"
+	"boot.httpserver/internal/response"
+)
+
+// Checker answers liveness and readiness probes. Readiness starts out
+// failing until SetReady(true) and can be made to depend on checks, such
+// as having an upstream to proxy to
+type Checker struct {
+	ready atomic.Bool
+
+	mu     sync.Mutex
+	checks map[string]func() error
+}
+
+func New() *Checker {
+	return &Checker{checks: map[string]func() error{}}
+}
+
+// SetReady flips readiness; clearing it at the start of a graceful
+// shutdown makes the orchestrator stop sending traffic before we stop
+func (c *Checker) SetReady(ready bool) {
+	c.ready.Store(ready)
+}
+
+func (c *Checker) Ready() bool {
+	return c.ready.Load()
+}
+
+// AddCheck makes readiness also require check to return nil
+func (c *Checker) AddCheck(name string, check func() error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks[name] = check
+}
+
+// Healthz reports that the process is up and serving
+func (c *Checker) Healthz(w *response.Writer, req *request.Request) {
+	writeStatus(w, response.OK, "ok\n")
+}
+
+// Readyz reports whether we should be sent traffic, listing the result of
+// every check when the query has verbose
+func (c *Checker) Readyz(w *response.Writer, req *request.Request) {
+	c.mu.Lock()
+	checks := maps.Clone(c.checks)
+	c.mu.Unlock()
+	names := slices.Sorted(maps.Keys(checks))
+
+	var report strings.Builder
+	failed := false
+	if !c.Ready() {
+		failed = true
+		report.WriteString("[-] ready: shutting down or not started\n")
+	}
+	for _, name := range names {
+		if err := checks[name](); err != nil {
+			failed = true
+			fmt.Fprintf(&report, "[-] %s: %v\n", name, err)
+		} else {
+			fmt.Fprintf(&report, "[+] %s ok\n", name)
+		}
+	}
+
+	statusCode, body := response.StatusCode(response.OK), "ok\n"
+	if failed {
+		statusCode, body = response.SERVICEUNAVAILABLE, "not ready\n"
+	}
+	if req.Query().Has("verbose") || failed {
+		body = report.String() + body
+	}
+	writeStatus(w, statusCode, body)
+}
+
+func writeStatus(w *response.Writer, statusCode response.StatusCode, body string) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
+	io.WriteString(w, body)
+}
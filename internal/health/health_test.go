@@ -0,0 +1,48 @@
+package health
+
+import (
+	"errors"
+	"testing"
+
+	"boot.httpserver/internal/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthz(t *testing.T) {
+	c := New()
+	out := testutil.Serve(c.Healthz, testutil.NewRequest("GET", "/healthz", nil))
+	assert.Contains(t, out, "HTTP/1.1 200 OK\r\n")
+	assert.Contains(t, out, "Cache-Control: no-store\r\n")
+}
+
+func TestReadyz(t *testing.T) {
+	c := New()
+
+	// Test: not ready until told so
+	out := testutil.Serve(c.Readyz, testutil.NewRequest("GET", "/readyz", nil))
+	assert.Contains(t, out, "HTTP/1.1 503 Service Unavailable\r\n")
+	assert.Contains(t, out, "[-] ready")
+
+	c.SetReady(true)
+	out = testutil.Serve(c.Readyz, testutil.NewRequest("GET", "/readyz", nil))
+	assert.Contains(t, out, "HTTP/1.1 200 OK\r\n")
+	assert.NotContains(t, out, "[+]")
+
+	var upstreamErr error
+	c.AddCheck("upstreams", func() error { return upstreamErr })
+	out = testutil.Serve(c.Readyz, testutil.NewRequest("GET", "/readyz?verbose", nil))
+	assert.Contains(t, out, "HTTP/1.1 200 OK\r\n")
+	assert.Contains(t, out, "[+] upstreams ok\n")
+
+	// Test: a failing check fails readiness but not liveness
+	upstreamErr = errors.New("none available")
+	out = testutil.Serve(c.Readyz, testutil.NewRequest("GET", "/readyz", nil))
+	assert.Contains(t, out, "HTTP/1.1 503 Service Unavailable\r\n")
+	assert.Contains(t, out, "[-] upstreams: none available\n")
+	assert.Contains(t, testutil.Serve(c.Healthz, testutil.NewRequest("GET", "/healthz", nil)), "HTTP/1.1 200 OK\r\n")
+
+	// Test: draining
+	upstreamErr = nil
+	c.SetReady(false)
+	assert.Contains(t, testutil.Serve(c.Readyz, testutil.NewRequest("GET", "/readyz", nil)), "HTTP/1.1 503 Service Unavailable\r\n")
+}
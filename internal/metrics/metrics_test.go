@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func render(t *testing.T, r *Registry) string {
+	var sb strings.Builder
+	n, err := r.WriteTo(&sb)
+	require.NoError(t, err)
+	assert.Equal(t, int64(sb.Len()), n)
+	return sb.String()
+}
+
+func TestTextFormat(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounterVec("requests_total", "Requests served.", "method", "status")
+	active := r.NewGauge("active_connections", "Open connections.")
+	duration := r.NewHistogram("duration_seconds", "Latency\nin seconds.", []float64{0.5, 0.1})
+
+	requests.With("GET", "200").Inc()
+	requests.With("GET", "200").Add(2)
+	requests.With("POST", `a"b\`).Inc()
+	active.Inc()
+	active.Inc()
+	active.Dec()
+	duration.Observe(0.05)
+	duration.Observe(0.3)
+	duration.Observe(3)
+
+	expected := `# HELP active_connections Open connections.
+# TYPE active_connections gauge
+active_connections 1
+# HELP duration_seconds Latency\nin seconds.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{le="0.1"} 1
+duration_seconds_bucket{le="0.5"} 2
+duration_seconds_bucket{le="+Inf"} 3
+duration_seconds_sum 3.35
+duration_seconds_count 3
+# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total{method="GET",status="200"} 3
+requests_total{method="POST",status="a\"b\\"} 1
+`
+	assert.Equal(t, expected, render(t, r))
+}
+
+func TestLabeledHistogram(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogramVec("latency_seconds", "Latency.", []float64{1}, "method")
+	h.With("GET").Observe(0.5)
+
+	out := render(t, r)
+	assert.Contains(t, out, `latency_seconds_bucket{method="GET",le="1"} 1`+"\n")
+	assert.Contains(t, out, `latency_seconds_bucket{method="GET",le="+Inf"} 1`+"\n")
+	assert.Contains(t, out, `latency_seconds_count{method="GET"} 1`+"\n")
+}
+
+func TestMisuse(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("c_total", "C.", "a")
+	assert.Panics(t, func() { c.With("x", "y") })
+	assert.Panics(t, func() { c.With("x").Add(-1) })
+	assert.Panics(t, func() { r.NewGauge("c_total", "again") })
+}
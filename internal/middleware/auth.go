@@ -0,0 +1,170 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"boot.httpserver/internal/request"
+	"boot.httpserver/internal/response"
+	"boot.httpserver/internal/server"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Identity is who a request authenticated as
+type Identity struct {
+	// the Basic user name or the token's sub claim
+	User string
+	// nil for Basic
+	Claims Claims
+}
+
+type identityKey struct{}
+
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
+
+// Htpasswd holds bcrypt password hashes by user, as written by
+// `htpasswd -B`
+type Htpasswd struct {
+	users map[string][]byte
+}
+
+func LoadHtpasswd(path string) (*Htpasswd, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	users, err := ParseHtpasswd(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return users, nil
+}
+
+// ParseHtpasswd reads "user:hash" lines, skipping blank lines and
+// comments. Hashes other than bcrypt are rejected rather than ignored so
+// a user isn't silently locked out
+func ParseHtpasswd(r io.Reader) (*Htpasswd, error) {
+	h := &Htpasswd{users: map[string][]byte{}}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("line %d: expected user:hash", n)
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("line %d: %s: only bcrypt hashes are supported", n, user)
+		}
+		if _, exists := h.users[user]; exists {
+			return nil, fmt.Errorf("line %d: duplicate user %s", n, user)
+		}
+		h.users[user] = []byte(hash)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// unknown users are checked against this so they take as long to reject
+// as a wrong password
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("dummy"), bcrypt.DefaultCost)
+	return hash
+})
+
+// Authenticate compares in constant time; bcrypt does the comparing
+func (h *Htpasswd) Authenticate(user, password string) bool {
+	hash, ok := h.users[user]
+	if !ok {
+		hash = dummyHash()
+	}
+	err := bcrypt.CompareHashAndPassword(hash, []byte(password))
+	return ok && err == nil
+}
+
+// BasicAuth lets through requests carrying the credentials of a user in
+// users and challenges everything else with 401
+func BasicAuth(realm string, users *Htpasswd) server.Middleware {
+	challenge := fmt.Sprintf(`Basic realm=%s, charset="UTF-8"`, quote(realm))
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			user, password, ok := basicCredentials(req)
+			if !ok || !users.Authenticate(user, password) {
+				w.Header().Set("WWW-Authenticate", challenge)
+				server.WriteError(w, req, response.UNAUTHORIZED, "unauthorized")
+				return
+			}
+			ctx := context.WithValue(req.Context(), identityKey{}, Identity{User: user})
+			next(w, req.WithContext(ctx))
+		}
+	}
+}
+
+func basicCredentials(req *request.Request) (string, string, bool) {
+	encoded, ok := authorization(req, "Basic")
+	if !ok {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", false
+	}
+	return strings.Cut(string(decoded), ":")
+}
+
+// BearerAuth lets through requests whose bearer token verifier accepts.
+// Challenges follow RFC 6750: no error code when there was no token,
+// invalid_token when it was rejected
+func BearerAuth(realm string, verifier TokenVerifier) server.Middleware {
+	challenge := "Bearer realm=" + quote(realm)
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			token, ok := authorization(req, "Bearer")
+			if !ok {
+				w.Header().Set("WWW-Authenticate", challenge)
+				server.WriteError(w, req, response.UNAUTHORIZED, "unauthorized")
+				return
+			}
+			claims, err := verifier.VerifyToken(token)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`%s, error="invalid_token", error_description=%s`, challenge, quote(err.Error())))
+				server.WriteError(w, req, response.UNAUTHORIZED, "unauthorized")
+				return
+			}
+			sub, _ := claims["sub"].(string)
+			ctx := context.WithValue(req.Context(), identityKey{}, Identity{User: sub, Claims: claims})
+			next(w, req.WithContext(ctx))
+		}
+	}
+}
+
+// authorization returns the credentials of an Authorization header using
+// scheme, which is matched case-insensitively
+func authorization(req *request.Request, scheme string) (string, bool) {
+	value, _ := req.Headers.Get("Authorization")
+	prefix, credentials, ok := strings.Cut(value, " ")
+	if !ok || !strings.EqualFold(prefix, scheme) {
+		return "", false
+	}
+	credentials = strings.TrimSpace(credentials)
+	return credentials, credentials != ""
+}
+
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"boot.httpserver/internal/request"
+	"boot.httpserver/internal/response"
+	"boot.httpserver/internal/server"
+	"boot.httpserver/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func htpasswdLine(t *testing.T, user, password string) string {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	require.NoError(t, err)
+	return user + ":" + string(hash)
+}
+
+// whoami answers with the authenticated user
+func whoami(w *response.Writer, req *request.Request) {
+	id, _ := IdentityFromContext(req.Context())
+	staticHandler("text/plain", id.User)(w, req)
+}
+
+func basic(user, password string) map[string]string {
+	return map[string]string{"authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))}
+}
+
+func TestParseHtpasswd(t *testing.T) {
+	file := "# admins\n\n" + htpasswdLine(t, "alice", "s3cret") + "\n"
+	users, err := ParseHtpasswd(strings.NewReader(file))
+	require.NoError(t, err)
+	assert.True(t, users.Authenticate("alice", "s3cret"))
+	assert.False(t, users.Authenticate("alice", "wrong"))
+	assert.False(t, users.Authenticate("bob", "s3cret"))
+
+	// Test: hashes other than bcrypt are refused
+	_, err = ParseHtpasswd(strings.NewReader("bob:$apr1$abc$def\n"))
+	assert.ErrorContains(t, err, "line 1: bob: only bcrypt")
+
+	// Test: malformed lines and duplicates
+	_, err = ParseHtpasswd(strings.NewReader("nocolon\n"))
+	assert.ErrorContains(t, err, "expected user:hash")
+	_, err = ParseHtpasswd(strings.NewReader(file + htpasswdLine(t, "alice", "x")))
+	assert.ErrorContains(t, err, "duplicate user alice")
+}
+
+func TestBasicAuth(t *testing.T) {
+	users, err := ParseHtpasswd(strings.NewReader(htpasswdLine(t, "alice", "pa:ss")))
+	require.NoError(t, err)
+	handler := server.Chain(whoami, BasicAuth("admin", users))
+
+	// Test: good credentials reach the handler, colons allowed in the password
+	res := testutil.Do(t, handler, testutil.NewRequest("GET", "/", basic("alice", "pa:ss")))
+	assert.Equal(t, 200, res.StatusCode)
+	body, _ := io.ReadAll(res.Body)
+	assert.Equal(t, "alice", string(body))
+
+	// Test: the scheme is case-insensitive
+	h := basic("alice", "pa:ss")
+	h["authorization"] = strings.Replace(h["authorization"], "Basic", "basic", 1)
+	assert.Equal(t, 200, testutil.Do(t, handler, testutil.NewRequest("GET", "/", h)).StatusCode)
+
+	// Test: everything else is challenged
+	for _, h := range []map[string]string{
+		nil,
+		basic("alice", "wrong"),
+		basic("mallory", "pa:ss"),
+		{"authorization": "Basic !!!"},
+		{"authorization": "Bearer abc"},
+	} {
+		res := testutil.Do(t, handler, testutil.NewRequest("GET", "/", h))
+		assert.Equal(t, 401, res.StatusCode)
+		assert.Equal(t, `Basic realm="admin", charset="UTF-8"`, res.Header.Get("WWW-Authenticate"))
+	}
+}
+
+func TestBearerAuth(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	v, err := NewHMACVerifier("HS256", key)
+	require.NoError(t, err)
+	v.now = func() time.Time { return time.Unix(1000, 0) }
+	handler := server.Chain(whoami, BearerAuth("api", v))
+
+	// Test: a valid token reaches the handler with its subject
+	token := signHS256(t, key, `{"sub":"svc-deploy","exp":2000}`)
+	res := testutil.Do(t, handler, testutil.NewRequest("GET", "/", map[string]string{"authorization": "Bearer " + token}))
+	assert.Equal(t, 200, res.StatusCode)
+	body, _ := io.ReadAll(res.Body)
+	assert.Equal(t, "svc-deploy", string(body))
+
+	// Test: no token gets a bare challenge
+	res = testutil.Do(t, handler, testutil.NewRequest("GET", "/", nil))
+	assert.Equal(t, 401, res.StatusCode)
+	assert.Equal(t, `Bearer realm="api"`, res.Header.Get("WWW-Authenticate"))
+
+	// Test: a rejected token says why
+	expired := signHS256(t, key, `{"sub":"svc-deploy","exp":500}`)
+	res = testutil.Do(t, handler, testutil.NewRequest("GET", "/", map[string]string{"authorization": fmt.Sprintf("Bearer %s", expired)}))
+	assert.Equal(t, 401, res.StatusCode)
+	assert.Equal(t, `Bearer realm="api", error="invalid_token", error_description="invalid token: token expired"`, res.Header.Get("WWW-Authenticate"))
+}
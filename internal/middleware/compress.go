@@ -0,0 +1,186 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strconv"
+	"strings"
+
+	"boot.httpserver/internal/headers"
+	"boot.httpserver/internal/request"
+	"boot.httpserver/internal/response"
+	"boot.httpserver/internal/server"
+)
+
+// bodies shorter than this grow rather than shrink once compressed
+const minCompressSize = 256
+
+// encodings we can produce, in order of preference on ties
+var supportedEncodings = []string{"gzip", "deflate"}
+
+// content types that are already compressed
+var incompressibleTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"font/woff",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/zstd",
+	"application/octet-stream",
+}
+
+// Compress encodes response bodies with gzip or deflate at level
+// according to the request's Accept-Encoding
+func Compress(level int) server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			acceptEncoding, _ := req.Headers.Get("Accept-Encoding")
+			encoding := negotiateEncoding(acceptEncoding)
+			head := req.RequestLine.Method == "HEAD"
+
+			var enc *encoder
+			w.AddFilter(func(statusCode response.StatusCode, h headers.Headers, body io.Writer) io.WriteCloser {
+				if !compressible(statusCode, h) {
+					return nil
+				}
+				addVary(h, "Accept-Encoding")
+				if encoding == "" {
+					return nil
+				}
+				if value, ok := h.Get("Content-Length"); ok {
+					if n, err := strconv.Atoi(value); err == nil && n < minCompressSize {
+						return nil
+					}
+				}
+
+				h.Delete("Content-Length")
+				h.Delete("Accept-Ranges")
+				h.Set("Content-Encoding", encoding)
+				if te, ok := h.Get("Transfer-Encoding"); !ok || !strings.Contains(strings.ToLower(te), "chunked") {
+					h.Set("Transfer-Encoding", "chunked")
+				}
+				// the encoded bytes differ, so a strong validator no longer holds
+				if etag, ok := h.Get("ETag"); ok && !strings.HasPrefix(etag, "W/") {
+					h.Set("ETag", "W/"+etag)
+				}
+
+				// HEAD gets the same fields as GET but has no body to encode
+				if head {
+					return nil
+				}
+				enc = newEncoder(encoding, body, level)
+				return enc
+			})
+
+			next(w, req)
+			// write the compressed tail while the handler's response is
+			// still ours; ending the message is left to the server
+			if enc != nil {
+				enc.Close()
+			}
+		}
+	}
+}
+
+// encoder is a gzip or zlib writer that can be closed more than once:
+// by the middleware when the handler returns, then by the writer
+type encoder struct {
+	zw interface {
+		io.WriteCloser
+		Flush() error
+	}
+	closed bool
+}
+
+func newEncoder(encoding string, w io.Writer, level int) *encoder {
+	if encoding == "deflate" {
+		zw, err := zlib.NewWriterLevel(w, level)
+		if err != nil {
+			zw = zlib.NewWriter(w)
+		}
+		return &encoder{zw: zw}
+	}
+	gw, err := gzip.NewWriterLevel(w, level)
+	if err != nil {
+		gw = gzip.NewWriter(w)
+	}
+	return &encoder{zw: gw}
+}
+
+func (e *encoder) Write(p []byte) (int, error) {
+	return e.zw.Write(p)
+}
+
+func (e *encoder) Flush() error {
+	return e.zw.Flush()
+}
+
+// Close writes the stream's tail once; zlib would repeat its checksum
+func (e *encoder) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	return e.zw.Close()
+}
+
+// negotiateEncoding picks the supported coding with the highest q value,
+// or "" when the client didn't ask for one or refused them all
+func negotiateEncoding(acceptEncoding string) string {
+	if acceptEncoding == "" {
+		return ""
+	}
+	qvalues := map[string]float64{}
+	for _, qv := range headers.ParseQualityValues(acceptEncoding) {
+		if _, seen := qvalues[qv.Value]; !seen {
+			qvalues[qv.Value] = qv.Q
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range supportedEncodings {
+		q, ok := qvalues[encoding]
+		if !ok {
+			q, ok = qvalues["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+func compressible(statusCode response.StatusCode, h headers.Headers) bool {
+	if statusCode < 200 || statusCode == 204 || statusCode == response.PARTIALCONTENT || statusCode == response.NOTMODIFIED {
+		return false
+	}
+	if _, ok := h.Get("Content-Encoding"); ok {
+		return false
+	}
+	contentType, _ := h.Get("Content-Type")
+	contentType = strings.ToLower(contentType)
+	for _, prefix := range incompressibleTypes {
+		if strings.HasPrefix(contentType, prefix) && contentType != "image/svg+xml" {
+			return false
+		}
+	}
+	return true
+}
+
+func addVary(h headers.Headers, field string) {
+	vary, ok := h.Get("Vary")
+	if !ok || vary == "" {
+		h.Set("Vary", field)
+		return
+	}
+	for _, existing := range strings.Split(vary, ",") {
+		existing = strings.TrimSpace(existing)
+		if existing == "*" || strings.EqualFold(existing, field) {
+			return
+		}
+	}
+	h.Set("Vary", vary+", "+field)
+}
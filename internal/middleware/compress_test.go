@@ -0,0 +1,183 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"boot.httpserver/internal/request"
+	"boot.httpserver/internal/response"
+	"boot.httpserver/internal/server"
+	"boot.httpserver/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func staticHandler(contentType, body string) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		h := response.GetDefaultHeaders(len(body))
+		h.Set("Content-Type", contentType)
+		w.WriteStatusLine(response.OK)
+		w.WriteHeaders(h)
+		w.WriteBody([]byte(body))
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	assert.Equal(t, "", negotiateEncoding(""))
+	assert.Equal(t, "gzip", negotiateEncoding("gzip, deflate, br"))
+	assert.Equal(t, "deflate", negotiateEncoding("gzip;q=0.5, deflate"))
+	assert.Equal(t, "deflate", negotiateEncoding("br, *;q=0.1, gzip;q=0"))
+	assert.Equal(t, "", negotiateEncoding("br, identity"))
+	assert.Equal(t, "", negotiateEncoding("*;q=0"))
+}
+
+func TestCompress(t *testing.T) {
+	body := strings.Repeat("<p>compress me</p>\n", 100)
+	handler := server.Chain(staticHandler("text/html", body), Compress(gzip.DefaultCompression))
+
+	// Test: gzip switches to chunked framing
+	res := testutil.Do(t, handler, testutil.NewRequest("GET", "/", map[string]string{"accept-encoding": "gzip"}))
+	assert.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", res.Header.Get("Vary"))
+	assert.Equal(t, []string{"chunked"}, res.TransferEncoding)
+	gr, err := gzip.NewReader(res.Body)
+	require.NoError(t, err)
+	decoded, err := io.ReadAll(gr)
+	require.NoError(t, err)
+	assert.Equal(t, body, string(decoded))
+
+	// Test: deflate
+	res = testutil.Do(t, handler, testutil.NewRequest("GET", "/", map[string]string{"accept-encoding": "deflate"}))
+	assert.Equal(t, "deflate", res.Header.Get("Content-Encoding"))
+	zr, err := zlib.NewReader(res.Body)
+	require.NoError(t, err)
+	decoded, err = io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, body, string(decoded))
+
+	// Test: no Accept-Encoding leaves the body alone but still varies
+	res = testutil.Do(t, handler, testutil.NewRequest("GET", "/", nil))
+	assert.Equal(t, "", res.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", res.Header.Get("Vary"))
+	raw, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, body, string(raw))
+
+	// Test: HEAD carries the headers GET would, without a body
+	res = testutil.Do(t, handler, testutil.NewRequest("HEAD", "/", map[string]string{"accept-encoding": "gzip"}))
+	assert.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+	assert.Equal(t, []string{"chunked"}, res.TransferEncoding)
+	assert.Equal(t, "", res.Header.Get("Content-Length"))
+	raw, err = io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Empty(t, raw)
+
+	// Test: HEAD and GET agree on the validator too
+	tagged := server.Chain(func(w *response.Writer, req *request.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		staticHandler("text/html", body)(w, req)
+	}, Compress(gzip.DefaultCompression))
+	get := testutil.Do(t, tagged, testutil.NewRequest("GET", "/", map[string]string{"accept-encoding": "gzip"}))
+	head := testutil.Do(t, tagged, testutil.NewRequest("HEAD", "/", map[string]string{"accept-encoding": "gzip"}))
+	assert.Equal(t, `W/"v1"`, get.Header.Get("ETag"))
+	assert.Equal(t, get.Header, head.Header)
+}
+
+func TestCompressLeavesFinishToServer(t *testing.T) {
+	body := strings.Repeat("<p>compress me</p>\n", 100)
+	handler := server.Chain(staticHandler("text/html", body), Compress(gzip.DefaultCompression))
+
+	for _, encoding := range []string{"gzip", "deflate"} {
+		buf := &bytes.Buffer{}
+		w := &response.Writer{Wrt: buf, Method: "GET"}
+		handler(w, testutil.NewRequest("GET", "/", map[string]string{"accept-encoding": encoding}))
+
+		// Test: the response is still open once the middleware returns
+		assert.NotContains(t, buf.String(), "\r\n0\r\n\r\n", encoding)
+		require.NoError(t, w.Finish())
+
+		// Test: finishing after the encoder closed adds no second tail
+		res, err := http.ReadResponse(bufio.NewReader(buf), &http.Request{Method: "GET"})
+		require.NoError(t, err)
+		raw, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		rest := bytes.NewReader(raw)
+		var zr io.Reader
+		if encoding == "gzip" {
+			zr, err = gzip.NewReader(rest)
+		} else {
+			zr, err = zlib.NewReader(rest)
+		}
+		require.NoError(t, err)
+		decoded, err := io.ReadAll(zr)
+		require.NoError(t, err)
+		assert.Equal(t, body, string(decoded), encoding)
+		assert.Zero(t, rest.Len(), encoding)
+	}
+}
+
+func TestCompressSkips(t *testing.T) {
+	// Test: already compressed media
+	video := server.Chain(staticHandler("video/mp4", strings.Repeat("x", 1000)), Compress(gzip.DefaultCompression))
+	res := testutil.Do(t, video, testutil.NewRequest("GET", "/", map[string]string{"accept-encoding": "gzip"}))
+	assert.Equal(t, "", res.Header.Get("Content-Encoding"))
+	assert.Equal(t, "", res.Header.Get("Vary"))
+
+	// Test: tiny bodies
+	tiny := server.Chain(staticHandler("text/plain", "hi"), Compress(gzip.DefaultCompression))
+	res = testutil.Do(t, tiny, testutil.NewRequest("GET", "/", map[string]string{"accept-encoding": "gzip"}))
+	assert.Equal(t, "", res.Header.Get("Content-Encoding"))
+	assert.Equal(t, int64(2), res.ContentLength)
+}
+
+func TestCompressChunkedWithTrailers(t *testing.T) {
+	handler := server.Chain(func(w *response.Writer, req *request.Request) {
+		h := response.GetDefaultHeaders(0)
+		delete(h, "Content-Length")
+		h.Set("Transfer-Encoding", "chunked")
+		h.Set("Trailer", "X-Done")
+		w.WriteStatusLine(response.OK)
+		w.WriteHeaders(h)
+		for i := 0; i < 10; i++ {
+			w.WriteChunkedBody([]byte(strings.Repeat("chunk ", 20)))
+		}
+		w.WriteChunkedBodyDone()
+		w.WriteTrailers(map[string]string{"X-Done": "yes"})
+	}, Compress(gzip.DefaultCompression))
+
+	res := testutil.Do(t, handler, testutil.NewRequest("GET", "/", map[string]string{"accept-encoding": "gzip"}))
+	gr, err := gzip.NewReader(res.Body)
+	require.NoError(t, err)
+	decoded, err := io.ReadAll(gr)
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("chunk ", 200), string(decoded))
+	assert.Equal(t, "yes", res.Trailer.Get("X-Done"))
+}
+
+func TestCompressInferredLength(t *testing.T) {
+	body := strings.Repeat("{\"hello\":\"world\"}\n", 50)
+	handler := server.Chain(func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.OK)
+		w.WriteHeaders(response.DefaultHeaders())
+		w.WriteBody([]byte(body))
+	}, Compress(gzip.DefaultCompression))
+
+	// Test: compressed once the buffered body proves big enough
+	res := testutil.Do(t, handler, testutil.NewRequest("GET", "/", map[string]string{"accept-encoding": "gzip"}))
+	assert.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+	gr, err := gzip.NewReader(res.Body)
+	require.NoError(t, err)
+	decoded, err := io.ReadAll(gr)
+	require.NoError(t, err)
+	assert.Equal(t, body, string(decoded))
+
+	// Test: left alone without Accept-Encoding and sized automatically
+	res = testutil.Do(t, handler, testutil.NewRequest("GET", "/", nil))
+	assert.Equal(t, int64(len(body)), res.ContentLength)
+}
@@ -0,0 +1,158 @@
+package middleware
+
+import (
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"boot.httpserver/internal/headers"
+	"boot.httpserver/internal/request"
+	"boot.httpserver/internal/response"
+	"boot.httpserver/internal/server"
+)
+
+type CORSOptions struct {
+	// origins allowed to make cross-origin requests: an exact origin such
+	// as "https://app.example.com", a subdomain wildcard such as
+	// "https://*.example.com", or "*" for any origin
+	AllowedOrigins []string
+	// origins matching any of these are allowed as well
+	AllowedOriginPatterns []*regexp.Regexp
+	// defaults to GET, HEAD and POST
+	AllowedMethods []string
+	// request headers a preflight may ask for, "*" allows any
+	AllowedHeaders []string
+	// response headers scripts may read besides the safelisted ones
+	ExposedHeaders []string
+	// let requests carry cookies and HTTP authentication; not allowed
+	// together with "*", which would hand any site the user's session
+	AllowCredentials bool
+	// how long browsers may cache a preflight answer, 0 leaves it to them
+	MaxAge time.Duration
+}
+
+var defaultCORSMethods = []string{"GET", "HEAD", "POST"}
+
+// CORS adds the Access-Control-* headers that let browsers on allowed
+// origins call the wrapped handler, and answers preflight requests itself.
+// It panics if "*" is combined with AllowCredentials
+func CORS(opts CORSOptions) server.Middleware {
+	anyOrigin := slices.Contains(opts.AllowedOrigins, "*")
+	if anyOrigin && opts.AllowCredentials {
+		panic(`middleware: CORS cannot allow credentials from origin "*"`)
+	}
+	methods := opts.AllowedMethods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	anyHeader := slices.Contains(opts.AllowedHeaders, "*")
+	allowedHeaders := map[string]bool{}
+	for _, name := range opts.AllowedHeaders {
+		allowedHeaders[strings.ToLower(name)] = true
+	}
+	originAllowed := func(origin string) bool {
+		if anyOrigin {
+			return true
+		}
+		for _, allowed := range opts.AllowedOrigins {
+			if matchOrigin(allowed, origin) {
+				return true
+			}
+		}
+		for _, pattern := range opts.AllowedOriginPatterns {
+			if pattern.MatchString(origin) {
+				return true
+			}
+		}
+		return false
+	}
+
+	allowOrigin := func(h headers.Headers, origin string) {
+		if anyOrigin {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if opts.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+	}
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			origin, hasOrigin := req.Headers.Get("Origin")
+			requestMethod, hasRequestMethod := req.Headers.Get("Access-Control-Request-Method")
+
+			if req.RequestLine.Method == "OPTIONS" && hasOrigin && hasRequestMethod {
+				h := response.DefaultHeaders()
+				addVary(h, "Origin")
+				addVary(h, "Access-Control-Request-Method")
+				addVary(h, "Access-Control-Request-Headers")
+
+				requested := splitList(req.Headers, "Access-Control-Request-Headers")
+				headersAllowed := anyHeader || !slices.ContainsFunc(requested, func(name string) bool {
+					return !allowedHeaders[strings.ToLower(name)]
+				})
+				// a rejected preflight just lacks the headers the browser looks for
+				if originAllowed(origin) && slices.Contains(methods, requestMethod) && headersAllowed {
+					allowOrigin(h, origin)
+					h.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+					if len(requested) > 0 {
+						h.Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+					}
+					if opts.MaxAge > 0 {
+						h.Set("Access-Control-Max-Age", strconv.Itoa(int(opts.MaxAge.Seconds())))
+					}
+				}
+				w.WriteStatusLine(response.NOCONTENT)
+				w.WriteHeaders(h)
+				return
+			}
+
+			w.AddFilter(func(statusCode response.StatusCode, h headers.Headers, body io.Writer) io.WriteCloser {
+				if !anyOrigin {
+					addVary(h, "Origin")
+				}
+				if !hasOrigin || !originAllowed(origin) {
+					return nil
+				}
+				allowOrigin(h, origin)
+				if len(opts.ExposedHeaders) > 0 {
+					h.Set("Access-Control-Expose-Headers", strings.Join(opts.ExposedHeaders, ", "))
+				}
+				return nil
+			})
+			next(w, req)
+		}
+	}
+}
+
+// matchOrigin compares origins case-insensitively; a "*." in allowed
+// stands for one or more subdomain labels, never the bare domain
+func matchOrigin(allowed, origin string) bool {
+	allowed = strings.ToLower(allowed)
+	origin = strings.ToLower(origin)
+	scheme, host, ok := strings.Cut(allowed, "://*.")
+	if !ok {
+		return allowed == origin
+	}
+	rest, found := strings.CutPrefix(origin, scheme+"://")
+	if !found {
+		return false
+	}
+	return strings.HasSuffix(rest, "."+host) && len(rest) > len(host)+1
+}
+
+func splitList(h headers.Headers, name string) []string {
+	value, _ := h.Get(name)
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
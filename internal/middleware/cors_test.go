@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"boot.httpserver/internal/request"
+	"boot.httpserver/internal/response"
+	"boot.httpserver/internal/server"
+	"boot.httpserver/internal/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func corsHandler(opts CORSOptions) server.Handler {
+	return server.Chain(staticHandler("text/plain", "hello"), CORS(opts))
+}
+
+func TestMatchOrigin(t *testing.T) {
+	assert.True(t, matchOrigin("https://app.example.com", "https://APP.example.com"))
+	assert.False(t, matchOrigin("https://app.example.com", "http://app.example.com"))
+	assert.True(t, matchOrigin("https://*.example.com", "https://a.b.example.com"))
+	assert.False(t, matchOrigin("https://*.example.com", "https://example.com"))
+	assert.False(t, matchOrigin("https://*.example.com", "https://evilexample.com"))
+	assert.False(t, matchOrigin("https://*.example.com", "http://a.example.com"))
+}
+
+func TestCORSSimpleRequest(t *testing.T) {
+	handler := corsHandler(CORSOptions{
+		AllowedOrigins:        []string{"https://app.example.com", "https://*.example.org"},
+		AllowedOriginPatterns: []*regexp.Regexp{regexp.MustCompile(`^http://localhost:\d+$`)},
+		ExposedHeaders:        []string{"X-Request-Id"},
+		AllowCredentials:      true,
+	})
+
+	for _, origin := range []string{"https://app.example.com", "https://api.example.org", "http://localhost:3000"} {
+		res := testutil.Do(t, handler, testutil.NewRequest("GET", "/", map[string]string{"origin": origin}))
+		assert.Equal(t, 200, res.StatusCode)
+		assert.Equal(t, origin, res.Header.Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "true", res.Header.Get("Access-Control-Allow-Credentials"))
+		assert.Equal(t, "X-Request-Id", res.Header.Get("Access-Control-Expose-Headers"))
+		assert.Equal(t, "Origin", res.Header.Get("Vary"))
+	}
+
+	// Test: unknown origins get no CORS headers, the response still varies
+	res := testutil.Do(t, handler, testutil.NewRequest("GET", "/", map[string]string{"origin": "https://evil.com"}))
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Empty(t, res.Header.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Origin", res.Header.Get("Vary"))
+
+	// Test: same-origin requests are passed through
+	res = testutil.Do(t, handler, testutil.NewRequest("GET", "/", nil))
+	assert.Empty(t, res.Header.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Origin", res.Header.Get("Vary"))
+}
+
+func TestCORSWildcard(t *testing.T) {
+	res := testutil.Do(t, corsHandler(CORSOptions{AllowedOrigins: []string{"*"}}), testutil.NewRequest("GET", "/", map[string]string{"origin": "https://any.com"}))
+	assert.Equal(t, "*", res.Header.Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, res.Header.Get("Vary"))
+
+	// Test: any origin with credentials is refused up front
+	assert.Panics(t, func() {
+		CORS(CORSOptions{AllowedOrigins: []string{"*"}, AllowCredentials: true})
+	})
+}
+
+func TestCORSPreflight(t *testing.T) {
+	called := false
+	handler := server.Chain(func(w *response.Writer, req *request.Request) {
+		called = true
+	}, CORS(CORSOptions{
+		AllowedOrigins: []string{"https://app.example.com"},
+		AllowedMethods: []string{"GET", "PUT"},
+		AllowedHeaders: []string{"Content-Type", "Authorization"},
+		MaxAge:         10 * time.Minute,
+	}))
+
+	res := testutil.Do(t, handler, testutil.NewRequest("OPTIONS", "/", map[string]string{
+		"origin":                         "https://app.example.com",
+		"access-control-request-method":  "PUT",
+		"access-control-request-headers": "content-type, authorization",
+	}))
+	assert.False(t, called)
+	assert.Equal(t, 204, res.StatusCode)
+	assert.Equal(t, "https://app.example.com", res.Header.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, PUT", res.Header.Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "content-type, authorization", res.Header.Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "600", res.Header.Get("Access-Control-Max-Age"))
+	assert.Equal(t, "Origin, Access-Control-Request-Method, Access-Control-Request-Headers", res.Header.Get("Vary"))
+
+	// Test: disallowed method or header
+	for _, h := range []map[string]string{
+		{"origin": "https://app.example.com", "access-control-request-method": "DELETE"},
+		{"origin": "https://app.example.com", "access-control-request-method": "PUT", "access-control-request-headers": "x-secret"},
+		{"origin": "https://evil.com", "access-control-request-method": "GET"},
+	} {
+		res := testutil.Do(t, handler, testutil.NewRequest("OPTIONS", "/", h))
+		assert.Equal(t, 204, res.StatusCode)
+		assert.Empty(t, res.Header.Get("Access-Control-Allow-Origin"))
+		assert.Empty(t, res.Header.Get("Access-Control-Allow-Methods"))
+	}
+
+	// Test: plain OPTIONS requests reach the handler
+	testutil.Do(t, server.Chain(func(w *response.Writer, req *request.Request) {
+		called = true
+		w.WriteHeader(response.NOCONTENT)
+	}, CORS(CORSOptions{AllowedOrigins: []string{"*"}})), testutil.NewRequest("OPTIONS", "/", map[string]string{"origin": "https://app.example.com"}))
+	assert.True(t, called)
+}
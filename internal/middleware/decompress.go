@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+
+	"boot.httpserver/internal/request"
+	"boot.httpserver/internal/response"
+	"boot.httpserver/internal/server"
+)
+
+// DecompressBody transparently decodes gzip and deflate request bodies,
+// rejecting any that inflate past limit bytes
+func DecompressBody(limit int64) server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			err := req.DecodeBody(limit)
+			switch {
+			case err == nil:
+				next(w, req)
+			case errors.Is(err, request.ErrBodyTooLarge):
+				server.WriteError(w, req, response.CONTENTTOOLARGE, "decoded body too large")
+			case errors.Is(err, request.ErrUnsupportedEncoding):
+				w.Header().Set("Accept-Encoding", "gzip, deflate")
+				server.WriteError(w, req, response.UNSUPPORTEDMEDIATYPE, "unsupported content encoding")
+			default:
+				log.Printf("error decoding request body: %v", err)
+				server.WriteError(w, req, response.BADREQUEST, "malformed request body")
+			}
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"io"
+	"testing"
+
+	"boot.httpserver/internal/server"
+	"boot.httpserver/internal/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecompressBodyErrors(t *testing.T) {
+	handler := server.Chain(staticHandler("text/plain", "ok"), DecompressBody(1<<20))
+
+	// Test: unknown codings are refused with the ones we take
+	res := testutil.Do(t, handler, testutil.NewRequest("POST", "/", map[string]string{"content-encoding": "br", "content-length": "0"}))
+	assert.Equal(t, 415, res.StatusCode)
+	assert.Equal(t, "gzip, deflate", res.Header.Get("Accept-Encoding"))
+	body, _ := io.ReadAll(res.Body)
+	assert.Equal(t, "unsupported content encoding", string(body))
+
+	// Test: JSON clients get problem details like every other error
+	res = testutil.Do(t, handler, testutil.NewRequest("POST", "/", map[string]string{"content-encoding": "br", "content-length": "0", "accept": "application/json"}))
+	assert.Equal(t, 415, res.StatusCode)
+	assert.Equal(t, "application/problem+json", res.Header.Get("Content-Type"))
+}
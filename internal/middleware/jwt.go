@@ -0,0 +1,172 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Claims is a decoded JWT payload; numbers are float64 as with any JSON
+type Claims map[string]any
+
+// TokenVerifier decides whether a bearer token is good and what it says
+type TokenVerifier interface {
+	VerifyToken(token string) (Claims, error)
+}
+
+var ErrInvalidToken = errors.New("invalid token")
+
+var hmacAlgorithms = map[string]func() hash.Hash{
+	"HS256": sha256.New,
+	"HS384": sha512.New384,
+	"HS512": sha512.New,
+}
+
+// HMACVerifier checks JWTs signed with a shared key. Only the algorithm
+// it was built for is accepted, so tokens claiming "none" or another
+// algorithm never get as far as the signature. exp and nbf are enforced
+// when present, iss and aud when configured
+type HMACVerifier struct {
+	Issuer   string
+	Audience string
+	// clock skew tolerated on exp and nbf
+	Leeway time.Duration
+
+	alg  string
+	hash func() hash.Hash
+	key  []byte
+	now  func() time.Time
+}
+
+// NewHMACVerifier wants a key at least as long as the hash output, as
+// RFC 7518 requires
+func NewHMACVerifier(alg string, key []byte) (*HMACVerifier, error) {
+	h, ok := hmacAlgorithms[alg]
+	if !ok {
+		return nil, fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	if size := h().Size(); len(key) < size {
+		return nil, fmt.Errorf("%s needs a key of at least %d bytes", alg, size)
+	}
+	return &HMACVerifier{
+		alg:  alg,
+		hash: h,
+		key:  bytes.Clone(key),
+		now:  time.Now,
+	}, nil
+}
+
+func (v *HMACVerifier) VerifyToken(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, invalidToken("malformed token")
+	}
+
+	var header struct {
+		Alg  string   `json:"alg"`
+		Crit []string `json:"crit"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, invalidToken("malformed header")
+	}
+	if header.Alg != v.alg {
+		return nil, invalidToken("unexpected algorithm")
+	}
+	if len(header.Crit) > 0 {
+		return nil, invalidToken("unsupported critical header")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, invalidToken("malformed signature")
+	}
+	mac := hmac.New(v.hash, v.key)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, invalidToken("bad signature")
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil || claims == nil {
+		return nil, invalidToken("malformed claims")
+	}
+	if err := v.checkClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (v *HMACVerifier) checkClaims(claims Claims) error {
+	now := v.now()
+	if exp, ok := claims["exp"]; ok {
+		t, ok := numericDate(exp)
+		if !ok {
+			return invalidToken("malformed exp")
+		}
+		if !now.Before(t.Add(v.Leeway)) {
+			return invalidToken("token expired")
+		}
+	}
+	if nbf, ok := claims["nbf"]; ok {
+		t, ok := numericDate(nbf)
+		if !ok {
+			return invalidToken("malformed nbf")
+		}
+		if now.Before(t.Add(-v.Leeway)) {
+			return invalidToken("token not valid yet")
+		}
+	}
+	if v.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != v.Issuer {
+			return invalidToken("wrong issuer")
+		}
+	}
+	if v.Audience != "" && !audienceContains(claims["aud"], v.Audience) {
+		return invalidToken("wrong audience")
+	}
+	return nil
+}
+
+func invalidToken(reason string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidToken, reason)
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// numericDate reads seconds since the epoch, fractions allowed. Values
+// beyond what int64 seconds hold are malformed rather than wrapped
+func numericDate(v any) (time.Time, bool) {
+	seconds, ok := v.(float64)
+	if !ok || math.IsNaN(seconds) || math.IsInf(seconds, 0) || math.Abs(seconds) >= 1<<63 {
+		return time.Time{}, false
+	}
+	sec, frac := math.Modf(seconds)
+	return time.Unix(int64(sec), int64(frac*1e9)), true
+}
+
+// aud is either a single string or an array of them
+func audienceContains(aud any, want string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == want
+	case []any:
+		return slices.Contains(aud, any(want))
+	}
+	return false
+}
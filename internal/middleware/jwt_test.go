@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func signHS256(t *testing.T, key []byte, claims string) string {
+	return signToken(t, key, `{"alg":"HS256","typ":"JWT"}`, claims)
+}
+
+func signToken(t *testing.T, key []byte, header, claims string) string {
+	t.Helper()
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + base64.RawURLEncoding.EncodeToString([]byte(claims))
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestHMACVerifier(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	v, err := NewHMACVerifier("HS256", key)
+	require.NoError(t, err)
+	v.now = func() time.Time { return time.Unix(1000, 0) }
+
+	claims, err := v.VerifyToken(signHS256(t, key, `{"sub":"alice","exp":1001,"nbf":999,"admin":true}`))
+	require.NoError(t, err)
+	assert.Equal(t, "alice", claims["sub"])
+	assert.Equal(t, true, claims["admin"])
+
+	reject := func(token, reason string) {
+		t.Helper()
+		_, err := v.VerifyToken(token)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+		assert.ErrorContains(t, err, reason)
+	}
+
+	// Test: expiry and not-before
+	reject(signHS256(t, key, `{"exp":1000}`), "token expired")
+	reject(signHS256(t, key, `{"nbf":1001}`), "not valid yet")
+	reject(signHS256(t, key, `{"exp":"tomorrow"}`), "malformed exp")
+
+	// Test: dates past 2262 don't wrap around into the past
+	reject(signHS256(t, key, `{"nbf":1e13}`), "not valid yet")
+	reject(signHS256(t, key, `{"nbf":1e19}`), "malformed nbf")
+	reject(signHS256(t, key, `{"exp":-1e300}`), "malformed exp")
+	_, err = v.VerifyToken(signHS256(t, key, `{"exp":1e13}`))
+	require.NoError(t, err)
+
+	// Test: leeway absorbs clock skew
+	v.Leeway = 5 * time.Second
+	_, err = v.VerifyToken(signHS256(t, key, `{"exp":998,"nbf":1003}`))
+	assert.NoError(t, err)
+	v.Leeway = 0
+
+	// Test: signature and algorithm
+	reject(signHS256(t, []byte("another key of thirty two bytes!"), `{}`), "bad signature")
+	reject(signToken(t, key, `{"alg":"none"}`, `{}`), "unexpected algorithm")
+	reject(signToken(t, key, `{"alg":"HS512"}`, `{}`), "unexpected algorithm")
+	reject(signToken(t, key, `{"alg":"HS256","crit":["exp"]}`, `{}`), "critical header")
+	alice := strings.Split(signHS256(t, key, `{"sub":"alice"}`), ".")
+	admin := strings.Split(signHS256(t, key, `{"sub":"admin"}`), ".")
+	reject(alice[0]+"."+admin[1]+"."+alice[2], "bad signature")
+	reject(alice[0]+"."+alice[1]+".!!", "malformed signature")
+	reject("a.b", "malformed token")
+	reject(signHS256(t, key, `[]`), "malformed claims")
+
+	// Test: issuer and audience once configured
+	v.Issuer, v.Audience = "https://auth.example.com", "api"
+	_, err = v.VerifyToken(signHS256(t, key, `{"iss":"https://auth.example.com","aud":["web","api"]}`))
+	assert.NoError(t, err)
+	_, err = v.VerifyToken(signHS256(t, key, `{"iss":"https://auth.example.com","aud":"api"}`))
+	assert.NoError(t, err)
+	reject(signHS256(t, key, `{"iss":"https://evil.example.com","aud":"api"}`), "wrong issuer")
+	reject(signHS256(t, key, `{"iss":"https://auth.example.com","aud":"web"}`), "wrong audience")
+	reject(signHS256(t, key, `{"iss":"https://auth.example.com"}`), "wrong audience")
+}
+
+func TestNewHMACVerifier(t *testing.T) {
+	_, err := NewHMACVerifier("RS256", make([]byte, 32))
+	assert.ErrorContains(t, err, "unsupported algorithm")
+	_, err = NewHMACVerifier("HS512", make([]byte, 32))
+	assert.ErrorContains(t, err, "at least 64 bytes")
+	_, err = NewHMACVerifier("HS384", make([]byte, 48))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"boot.httpserver/internal/clientkey"
+	"boot.httpserver/internal/request"
+	"boot.httpserver/internal/response"
+	"boot.httpserver/internal/server"
+)
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// RateLimiter is a token bucket per key: each holds up to Burst requests
+// and refills at Rate per second. Buckets that have filled back up are
+// indistinguishable from new ones and get dropped. A Rate of zero or
+// less disables the limiter
+type RateLimiter struct {
+	Rate  float64
+	Burst int
+	// requests with an empty key share one bucket
+	Key clientkey.Func
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewRateLimiter(rate float64, burst int, key clientkey.Func) *RateLimiter {
+	return &RateLimiter{
+		Rate:    rate,
+		Burst:   burst,
+		Key:     key,
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}
+}
+
+type RateLimitResult struct {
+	Allowed   bool
+	Remaining int
+	// until the next request would be allowed
+	RetryAfter time.Duration
+	// until the bucket is full again
+	Reset time.Duration
+}
+
+// Disabled reports whether the limiter lets everything through, as it
+// does for a rate of zero or less
+func (l *RateLimiter) Disabled() bool {
+	return l.Rate <= 0
+}
+
+// Allow takes a token from key's bucket if there is one
+func (l *RateLimiter) Allow(key string) RateLimitResult {
+	if l.Disabled() {
+		return RateLimitResult{Allowed: true, Remaining: l.Burst}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.Burst), updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(l.Burst), b.tokens+now.Sub(b.updated).Seconds()*l.Rate)
+	b.updated = now
+
+	result := RateLimitResult{}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = l.refillTime(1 - b.tokens)
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = l.refillTime(float64(l.Burst) - b.tokens)
+	return result
+}
+
+func (l *RateLimiter) refillTime(tokens float64) time.Duration {
+	return time.Duration(tokens / l.Rate * float64(time.Second))
+}
+
+// sweep drops full buckets, at most once per full refill period
+func (l *RateLimiter) sweep(now time.Time) {
+	full := l.refillTime(float64(l.Burst))
+	if now.Sub(l.lastSweep) < full {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) >= l.refillTime(float64(l.Burst)-b.tokens) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// RateLimit answers requests over the limit with 429 and tells every
+// client where it stands through the RateLimit-* headers
+func RateLimit(l *RateLimiter) server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			if l.Disabled() {
+				next(w, req)
+				return
+			}
+			result := l.Allow(l.Key(req))
+
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(l.Burst))
+			h.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+			if result.Allowed {
+				next(w, req)
+				return
+			}
+			h.Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			server.WriteError(w, req, response.TOOMANYREQUESTS, "rate limit exceeded")
+		}
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
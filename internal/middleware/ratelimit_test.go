@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+
+	"boot.httpserver/internal/clientkey"
+	"boot.httpserver/internal/server"
+	"boot.httpserver/internal/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	l := NewRateLimiter(2, 3, clientkey.Header("X-Api-Key"))
+	l.now = clock.now
+
+	for i := 2; i >= 0; i-- {
+		result := l.Allow("a")
+		assert.True(t, result.Allowed)
+		assert.Equal(t, i, result.Remaining)
+	}
+	result := l.Allow("a")
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 500*time.Millisecond, result.RetryAfter)
+	assert.Equal(t, 1500*time.Millisecond, result.Reset)
+
+	// Test: other keys have their own bucket
+	assert.True(t, l.Allow("b").Allowed)
+
+	// Test: tokens refill over time
+	clock.t = clock.t.Add(500 * time.Millisecond)
+	assert.True(t, l.Allow("a").Allowed)
+	assert.False(t, l.Allow("a").Allowed)
+
+	// Test: full buckets are evicted
+	clock.t = clock.t.Add(2 * time.Second)
+	l.Allow("c")
+	assert.Len(t, l.buckets, 1)
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	l := NewRateLimiter(0.5, 2, clientkey.Header("X-Api-Key"))
+	l.now = clock.now
+	handler := server.Chain(staticHandler("text/plain", "hello"), RateLimit(l))
+	h := map[string]string{"x-api-key": "secret"}
+
+	res := testutil.Do(t, handler, testutil.NewRequest("GET", "/", h))
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "2", res.Header.Get("RateLimit-Limit"))
+	assert.Equal(t, "1", res.Header.Get("RateLimit-Remaining"))
+	assert.Equal(t, "2", res.Header.Get("RateLimit-Reset"))
+
+	testutil.Do(t, handler, testutil.NewRequest("GET", "/", h))
+	res = testutil.Do(t, handler, testutil.NewRequest("GET", "/", h))
+	assert.Equal(t, 429, res.StatusCode)
+	assert.Equal(t, "2", res.Header.Get("Retry-After"))
+	assert.Equal(t, "0", res.Header.Get("RateLimit-Remaining"))
+	assert.Equal(t, "4", res.Header.Get("RateLimit-Reset"))
+}
+
+func TestRateLimitDisabled(t *testing.T) {
+	// Test: a zero rate lets everything through instead of dividing by it
+	l := NewRateLimiter(0, 1, clientkey.Header("X-Api-Key"))
+	for range 3 {
+		assert.True(t, l.Allow("a").Allowed)
+	}
+	handler := server.Chain(staticHandler("text/plain", "hello"), RateLimit(l))
+	testutil.Do(t, handler, testutil.NewRequest("GET", "/", nil))
+	res := testutil.Do(t, handler, testutil.NewRequest("GET", "/", nil))
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "", res.Header.Get("RateLimit-Limit"))
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"fmt"
+	"strconv"
+
+	"boot.httpserver/internal/request"
+	"boot.httpserver/internal/response"
+	"boot.httpserver/internal/server"
+	"boot.httpserver/internal/tracing"
+)
+
+// Trace runs every request in a server span, continuing the caller's
+// trace when it sent a valid traceparent. Handlers find the span in the
+// request context to start children or propagate it
+func Trace(tracer *tracing.Tracer) server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			method := req.RequestLine.Method
+			path := req.Path()
+			remote, _ := tracing.Extract(req.Headers)
+
+			ctx, span := tracer.StartRemote(req.Context(), method+" "+path, tracing.SpanKindServer, remote)
+			defer span.End()
+			span.SetAttribute("http.request.method", method)
+			span.SetAttribute("url.path", path)
+			span.SetAttribute("client.address", req.RemoteAddr)
+
+			next(w, req.WithContext(ctx))
+
+			status := w.Status()
+			span.SetAttribute("http.response.status_code", strconv.Itoa(int(status)))
+			if status >= 500 {
+				span.SetError(fmt.Errorf("responded %d", status))
+			}
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"testing"
+
+	"boot.httpserver/internal/request"
+	"boot.httpserver/internal/response"
+	"boot.httpserver/internal/server"
+	"boot.httpserver/internal/testutil"
+	"boot.httpserver/internal/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrace(t *testing.T) {
+	exporter := &tracing.InMemoryExporter{}
+	var inHandler *tracing.Span
+	handler := server.Chain(func(w *response.Writer, req *request.Request) {
+		inHandler = tracing.SpanFromContext(req.Context())
+		w.WriteHeader(response.INTERNALERROR)
+	}, Trace(tracing.NewTracer(exporter)))
+
+	res := testutil.Do(t, handler, testutil.NewRequest("GET", "/", map[string]string{
+		"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	}))
+	assert.Equal(t, 500, res.StatusCode)
+
+	spans := exporter.Spans()
+	require.Len(t, spans, 1)
+	span := spans[0]
+	assert.Same(t, inHandler, span)
+	assert.Equal(t, "GET /", span.Name)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", span.Parent.String())
+	assert.Equal(t, "500", span.Attributes()["http.response.status_code"])
+	assert.Error(t, span.Err)
+}
@@ -0,0 +1,85 @@
+package request
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrBodyTooLarge        = errors.New("body exceeds limit")
+	ErrUnsupportedEncoding = errors.New("unsupported content encoding")
+)
+
+// DecodeBody replaces a gzip or deflate encoded Body with its decoded
+// bytes, refusing to inflate past limit so a small upload can't expand
+// into gigabytes. Content-Encoding and Content-Length are updated to
+// describe the new body
+func (r *Request) DecodeBody(limit int64) error {
+	value, exists := r.Headers.Get("Content-Encoding")
+	if !exists {
+		return nil
+	}
+
+	var encodings []string
+	for _, encoding := range strings.Split(value, ",") {
+		encoding = strings.ToLower(strings.TrimSpace(encoding))
+		if encoding != "" && encoding != "identity" {
+			encodings = append(encodings, encoding)
+		}
+	}
+
+	body := r.Body
+	// codings are listed in the order they were applied
+	for i := len(encodings) - 1; i >= 0; i-- {
+		decoded, err := decode(encodings[i], body, limit)
+		if err != nil {
+			return err
+		}
+		body = decoded
+	}
+
+	r.Body = body
+	r.Headers.Delete("Content-Encoding")
+	r.Headers.Set("content-length", strconv.Itoa(len(body)))
+	return nil
+}
+
+func decode(encoding string, body []byte, limit int64) ([]byte, error) {
+	var reader io.ReadCloser
+	var err error
+	switch encoding {
+	case "gzip", "x-gzip":
+		reader, err = gzip.NewReader(bytes.NewReader(body))
+	case "deflate":
+		reader, err = newDeflateReader(body)
+	default:
+		return nil, ErrUnsupportedEncoding
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	decoded, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(decoded)) > limit {
+		return nil, ErrBodyTooLarge
+	}
+	return decoded, nil
+}
+
+// deflate is meant to be zlib wrapped but some clients send raw deflate
+func newDeflateReader(body []byte) (io.ReadCloser, error) {
+	if zr, err := zlib.NewReader(bytes.NewReader(body)); err == nil {
+		return zr, nil
+	}
+	return flate.NewReader(bytes.NewReader(body)), nil
+}
@@ -0,0 +1,90 @@
+package request
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	_, err := gw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, gw.Close())
+	return buf.Bytes()
+}
+
+func encodedRequest(t *testing.T, encoding string, body []byte) *Request {
+	r, err := RequestFromReader(strings.NewReader("POST /upload HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"Content-Encoding: " + encoding + "\r\n" +
+		"Content-Length: " + strconv.Itoa(len(body)) + "\r\n" +
+		"\r\n" + string(body)))
+	require.NoError(t, err)
+	return r
+}
+
+func TestDecodeBody(t *testing.T) {
+	payload := []byte(strings.Repeat("hello world!\n", 50))
+
+	// Test: gzip body
+	r := encodedRequest(t, "gzip", gzipBytes(t, payload))
+	require.NoError(t, r.DecodeBody(1<<20))
+	assert.Equal(t, payload, r.Body)
+	_, exists := r.Headers.Get("Content-Encoding")
+	assert.False(t, exists)
+	assert.Equal(t, strconv.Itoa(len(payload)), r.Headers["content-length"])
+
+	// Test: zlib wrapped deflate body
+	buf := &bytes.Buffer{}
+	zw := zlib.NewWriter(buf)
+	zw.Write(payload)
+	zw.Close()
+	r = encodedRequest(t, "deflate", buf.Bytes())
+	require.NoError(t, r.DecodeBody(1<<20))
+	assert.Equal(t, payload, r.Body)
+
+	// Test: raw deflate body
+	buf = &bytes.Buffer{}
+	fw, _ := flate.NewWriter(buf, flate.DefaultCompression)
+	fw.Write(payload)
+	fw.Close()
+	r = encodedRequest(t, "deflate", buf.Bytes())
+	require.NoError(t, r.DecodeBody(1<<20))
+	assert.Equal(t, payload, r.Body)
+
+	// Test: stacked codings are undone in reverse order
+	r = encodedRequest(t, "gzip, gzip", gzipBytes(t, gzipBytes(t, payload)))
+	require.NoError(t, r.DecodeBody(1<<20))
+	assert.Equal(t, payload, r.Body)
+
+	// Test: no Content-Encoding leaves the body alone
+	r, err := RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 2\r\n\r\nhi"))
+	require.NoError(t, err)
+	require.NoError(t, r.DecodeBody(1))
+	assert.Equal(t, "hi", string(r.Body))
+}
+
+func TestDecodeBodyErrors(t *testing.T) {
+	// Test: a highly compressible body past the limit
+	bomb := gzipBytes(t, make([]byte, 10<<20))
+	r := encodedRequest(t, "gzip", bomb)
+	assert.Less(t, len(bomb), 64<<10)
+	assert.ErrorIs(t, r.DecodeBody(1<<20), ErrBodyTooLarge)
+
+	// Test: unknown coding
+	r = encodedRequest(t, "br", []byte("whatever"))
+	assert.ErrorIs(t, r.DecodeBody(1<<20), ErrUnsupportedEncoding)
+
+	// Test: corrupt gzip
+	r = encodedRequest(t, "gzip", []byte("not gzip at all"))
+	assert.Error(t, r.DecodeBody(1<<20))
+}
@@ -0,0 +1,69 @@
+package request
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+)
+
+var ErrNotJSON = errors.New("content type is not json")
+
+// IsJSON reports whether the body is declared as application/json or a
+// +json type such as application/problem+json
+func (r *Request) IsJSON() bool {
+	value, ok := r.Headers.Get("Content-Type")
+	if !ok {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(value)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// DecodeJSON unmarshals the body into v. The body must hold exactly one
+// JSON value no larger than limit, and fields v doesn't know about are
+// rejected rather than silently dropped. The body has been read by now;
+// it's the reader's maxBody that keeps oversized uploads out of memory
+func (r *Request) DecodeJSON(v any, limit int64) error {
+	if !r.IsJSON() {
+		return ErrNotJSON
+	}
+	if int64(len(r.Body)) > limit {
+		return ErrBodyTooLarge
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(r.Body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return jsonError(err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("body must hold a single json value")
+	}
+	return nil
+}
+
+// jsonError rewords decoder errors into something fit to show a client
+func jsonError(err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return fmt.Errorf("malformed json at offset %d", syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		return fmt.Errorf("json field %q must be %s", typeErr.Field, typeErr.Type)
+	case err == io.EOF:
+		return errors.New("body is empty")
+	case err == io.ErrUnexpectedEOF:
+		return errors.New("body is truncated json")
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return fmt.Errorf("unknown json field %s", strings.TrimPrefix(err.Error(), "json: unknown field "))
+	}
+	return err
+}
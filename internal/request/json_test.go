@@ -0,0 +1,62 @@
+package request
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type user struct {
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+func jsonRequest(t *testing.T, contentType, body string) *Request {
+	r, err := RequestFromReader(strings.NewReader("POST /users HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"Content-Type: " + contentType + "\r\n" +
+		"Content-Length: " + strconv.Itoa(len(body)) + "\r\n" +
+		"\r\n" + body))
+	require.NoError(t, err)
+	return r
+}
+
+func TestDecodeJSON(t *testing.T) {
+	// Test: valid body, media type parameters are ignored
+	var u user
+	r := jsonRequest(t, "application/json; charset=utf-8", `{"name":"ada","age":36}`)
+	require.NoError(t, r.DecodeJSON(&u, 1<<10))
+	assert.Equal(t, user{Name: "ada", Age: 36}, u)
+
+	// Test: +json suffix types are json
+	r = jsonRequest(t, "application/merge-patch+json", `{"age":37}`)
+	require.NoError(t, r.DecodeJSON(&u, 1<<10))
+	assert.Equal(t, 37, u.Age)
+
+	// Test: wrong content type
+	r = jsonRequest(t, "text/plain", `{"name":"ada"}`)
+	assert.ErrorIs(t, r.DecodeJSON(&u, 1<<10), ErrNotJSON)
+
+	// Test: body over the limit
+	r = jsonRequest(t, "application/json", `{"name":"ada"}`)
+	assert.ErrorIs(t, r.DecodeJSON(&u, 4), ErrBodyTooLarge)
+
+	// Test: unknown fields are rejected
+	r = jsonRequest(t, "application/json", `{"name":"ada","admin":true}`)
+	assert.EqualError(t, r.DecodeJSON(&u, 1<<10), `unknown json field "admin"`)
+
+	// Test: trailing values are rejected
+	r = jsonRequest(t, "application/json", `{"name":"ada"}{"name":"bob"}`)
+	assert.Error(t, r.DecodeJSON(&u, 1<<10))
+
+	// Test: wrong field type
+	r = jsonRequest(t, "application/json", `{"age":"old"}`)
+	assert.EqualError(t, r.DecodeJSON(&u, 1<<10), `json field "age" must be int`)
+
+	// Test: syntax errors
+	r = jsonRequest(t, "application/json", `{"name":}`)
+	assert.EqualError(t, r.DecodeJSON(&u, 1<<10), "malformed json at offset 9")
+}
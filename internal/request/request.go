@@ -1,8 +1,11 @@
 package request
 
 import (
+	"context"
 	"errors"
 	"io"
+	"net"
+	"net/url"
 	"strconv"
 	"strings"
 	"unicode"
@@ -12,6 +15,11 @@ import (
 
 const bufferSize = 8
 
+var (
+	ErrMissingHost = errors.New("missing host header")
+	ErrInvalidHost = errors.New("invalid host header")
+)
+
 type ParserState int
 
 const (
@@ -26,6 +34,27 @@ type Request struct {
 	State       ParserState
 	Headers     headers.Headers
 	Body        []byte
+	RemoteAddr  string
+
+	ctx context.Context
+	// largest Content-Length accepted while parsing, 0 means no limit
+	maxBody int64
+}
+
+// Context carries request scoped values such as the trace span; it is
+// never nil
+func (r *Request) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// WithContext returns a shallow copy of r using ctx
+func (r *Request) WithContext(ctx context.Context) *Request {
+	r2 := *r
+	r2.ctx = ctx
+	return &r2
 }
 
 func (r *Request) parse(data []byte) (int, error) {
@@ -89,6 +118,10 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 			return 0, err
 		}
 
+		if r.maxBody > 0 && int64(num) > r.maxBody {
+			return 0, ErrBodyTooLarge
+		}
+
 		if len(data) > num {
 			return 0, errors.New("invalid length")
 		}
@@ -114,13 +147,48 @@ type RequestLine struct {
 	Method        string
 }
 
+// Path is the request target without its query
+func (r *Request) Path() string {
+	path, _, _ := strings.Cut(r.RequestLine.RequestTarget, "?")
+	return path
+}
+
+// Query parses the query of the request target; malformed pairs are
+// skipped
+func (r *Request) Query() url.Values {
+	_, query, _ := strings.Cut(r.RequestLine.RequestTarget, "?")
+	values, _ := url.ParseQuery(query)
+	return values
+}
+
+// Host is the host name the request is addressed to, lowercased and
+// without the port or IPv6 brackets
+func (r *Request) Host() string {
+	host, _ := r.Headers.Get("Host")
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	host = strings.TrimSuffix(strings.Trim(host, "[]"), ".")
+	return strings.ToLower(host)
+}
+
 func RequestFromReader(reader io.Reader) (*Request, error) {
+	request, _, err := ReadRequest(reader, 0)
+	return request, err
+}
+
+// ReadRequest is RequestFromReader but also returns whatever was read from
+// reader past the end of the request, e.g. the first frames of a protocol
+// the client switches to. A Content-Length over maxBody fails with
+// ErrBodyTooLarge before any of the body is read; 0 means no limit
+func ReadRequest(reader io.Reader, maxBody int64) (*Request, []byte, error) {
 	buf := make([]byte, bufferSize)
 	readToIndex := 0
 
 	request := &Request{
 		State:   Initialized,
 		Headers: make(headers.Headers),
+		maxBody: maxBody,
 	}
 
 	for request.State != Done {
@@ -138,7 +206,7 @@ func RequestFromReader(reader io.Reader) (*Request, error) {
 				request.State = Done
 				break
 			}
-			return nil, err
+			return nil, nil, err
 		}
 
 		readToIndex += n
@@ -146,7 +214,7 @@ func RequestFromReader(reader io.Reader) (*Request, error) {
 		n, err = request.parse(buf[:readToIndex])
 
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		copy(buf, buf[n:])
@@ -158,23 +226,31 @@ func RequestFromReader(reader io.Reader) (*Request, error) {
 		num, err := strconv.Atoi(value)
 
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		if len(request.Body) < num {
-			return nil, errors.New("invalid length")
+			return nil, nil, errors.New("invalid length")
 		}
 	}
 
 	if !isAllUpperCase(request.RequestLine.Method) {
-		return nil, errors.New("method not allowed")
+		return nil, nil, errors.New("method not allowed")
 	}
 
 	if request.RequestLine.HttpVersion != "1.1" {
-		return nil, errors.New("http version not supported")
+		return nil, nil, errors.New("http version not supported")
 	}
 
-	return request, nil
+	host, exists := request.Headers.Get("Host")
+	if !exists {
+		return nil, nil, ErrMissingHost
+	}
+	if !validHost(host) {
+		return nil, nil, ErrInvalidHost
+	}
+
+	return request, buf[:readToIndex], nil
 }
 
 func parseRequestLine(line []byte) (*RequestLine, int, error) {
@@ -214,3 +290,49 @@ func isAllUpperCase(s string) bool {
 	}
 	return true
 }
+
+// validHost checks a Host value against RFC 9110's uri-host [ ":" port ].
+// An empty value is allowed for targets without an authority; repeated
+// Host headers are merged with ", " by the header parser and so never
+// pass, since reg-names can't hold spaces
+func validHost(host string) bool {
+	name, port := host, ""
+	if strings.HasPrefix(host, "[") {
+		end := strings.Index(host, "]")
+		if end == -1 {
+			return false
+		}
+		ip := net.ParseIP(host[1:end])
+		if ip == nil || !strings.Contains(host[1:end], ":") {
+			return false
+		}
+		name, port = "", host[end+1:]
+		if port != "" && !strings.HasPrefix(port, ":") {
+			return false
+		}
+	} else if i := strings.LastIndex(host, ":"); i != -1 {
+		name, port = host[:i], host[i:]
+	}
+
+	for _, c := range strings.TrimPrefix(port, ":") {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.IndexByte("-._~!$&'()*+,;=", c) != -1:
+		case c == '%' && i+2 < len(name) && isHex(name[i+1]) && isHex(name[i+2]):
+			i += 2
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
@@ -207,3 +207,74 @@ func (cr *chunkReader) Read(p []byte) (n int, err error) {
 
 	return n, nil
 }
+
+func TestReadRequestBuffered(t *testing.T) {
+	// Test: bytes past the request are handed back
+	r, buffered, err := ReadRequest(strings.NewReader("GET /ws HTTP/1.1\r\nHost: localhost:42069\r\n\r\n\x81\x85frame"), 0)
+	require.NoError(t, err)
+	assert.Equal(t, "/ws", r.RequestLine.RequestTarget)
+	assert.Equal(t, "\x81\x85frame", string(buffered))
+
+	// Test: nothing extra
+	_, buffered, err = ReadRequest(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"), 0)
+	require.NoError(t, err)
+	assert.Empty(t, buffered)
+}
+
+func TestReadRequestMaxBody(t *testing.T) {
+	// Test: the declared length is refused before the body is read
+	_, _, err := ReadRequest(strings.NewReader("POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 1000000\r\n\r\n"), 10)
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// Test: bodies up to the limit are fine
+	r, _, err := ReadRequest(strings.NewReader("POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 10\r\n\r\n0123456789"), 10)
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", string(r.Body))
+}
+
+func TestPathAndQuery(t *testing.T) {
+	r := &Request{RequestLine: RequestLine{RequestTarget: "/debug/pprof/heap?debug=1&gc=1"}}
+	assert.Equal(t, "/debug/pprof/heap", r.Path())
+	assert.Equal(t, "1", r.Query().Get("debug"))
+	assert.Equal(t, "1", r.Query().Get("gc"))
+
+	r = &Request{RequestLine: RequestLine{RequestTarget: "/"}}
+	assert.Equal(t, "/", r.Path())
+	assert.Empty(t, r.Query())
+}
+
+func TestHostHeader(t *testing.T) {
+	read := func(hostLines string) (*Request, error) {
+		return RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\n" + hostLines + "Accept: */*\r\n\r\n"))
+	}
+
+	// Test: valid forms
+	for _, host := range []string{"example.com", "Example.COM:8080", "127.0.0.1:42069", "[::1]:8080", "[::1]", "my%2Dhost", ""} {
+		_, err := read("Host: " + host + "\r\n")
+		assert.NoError(t, err, host)
+	}
+
+	// Test: missing Host
+	_, err := read("")
+	assert.ErrorIs(t, err, ErrMissingHost)
+
+	// Test: repeated Host, even with the same value
+	_, err = read("Host: example.com\r\nHost: example.com\r\n")
+	assert.ErrorIs(t, err, ErrInvalidHost)
+	_, err = read("Host: \r\nHost: \r\n")
+	assert.ErrorIs(t, err, ErrInvalidHost)
+
+	// Test: malformed values
+	for _, host := range []string{"exa mple.com", "example.com:80a", "user@example.com", "example.com/path", "[::1", "[example.com]", "[::1]x", "bad%zz"} {
+		_, err := read("Host: " + host + "\r\n")
+		assert.ErrorIs(t, err, ErrInvalidHost, host)
+	}
+
+	// Test: Host() drops the port, brackets and trailing dot
+	r, err := read("Host: WWW.Example.com.:8080\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, "www.example.com", r.Host())
+	r, err = read("Host: [::1]:8080\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, "::1", r.Host())
+}
@@ -0,0 +1,146 @@
+package response
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"boot.httpserver/internal/headers"
+	"boot.httpserver/internal/request"
+)
+
+func StrongETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+func WeakETag(data []byte) string {
+	return "W/" + StrongETag(data)
+}
+
+// ModTimeETag derives a validator from file metadata without reading the
+// content, the same way nginx does
+func ModTimeETag(modtime time.Time, size int64) string {
+	return fmt.Sprintf(`"%x-%x"`, modtime.Unix(), size)
+}
+
+func isWeak(etag string) bool {
+	return strings.HasPrefix(etag, "W/")
+}
+
+func opaqueTag(etag string) string {
+	return strings.TrimPrefix(etag, "W/")
+}
+
+func StrongMatch(a, b string) bool {
+	return a != "" && !isWeak(a) && !isWeak(b) && a == b
+}
+
+func WeakMatch(a, b string) bool {
+	return a != "" && opaqueTag(a) == opaqueTag(b)
+}
+
+// parseETags splits an If-Match / If-None-Match list; commas may appear
+// inside a quoted tag so a plain split is not enough
+func parseETags(value string) []string {
+	var tags []string
+	for {
+		value = strings.TrimLeft(value, " \t,")
+		if value == "" {
+			return tags
+		}
+		if value[0] == '*' {
+			tags = append(tags, "*")
+			value = value[1:]
+			continue
+		}
+		prefix := ""
+		if strings.HasPrefix(value, "W/") {
+			prefix = "W/"
+			value = value[2:]
+		}
+		if value == "" || value[0] != '"' {
+			return tags
+		}
+		end := strings.IndexByte(value[1:], '"')
+		if end == -1 {
+			return tags
+		}
+		tags = append(tags, prefix+value[:end+2])
+		value = value[end+2:]
+	}
+}
+
+func matchesAny(value, etag string, match func(a, b string) bool) bool {
+	for _, tag := range parseETags(value) {
+		if tag == "*" {
+			if etag != "" {
+				return true
+			}
+			continue
+		}
+		if match(etag, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// EvaluatePreconditions applies If-Match, If-Unmodified-Since,
+// If-None-Match and If-Modified-Since in the order of RFC 9110 13.2.2.
+// It returns OK when the request should be processed normally, otherwise
+// NOTMODIFIED or PRECONDITIONFAILED
+func EvaluatePreconditions(req *request.Request, etag string, modtime time.Time) StatusCode {
+	method := req.RequestLine.Method
+	safe := method == "GET" || method == "HEAD"
+	modtime = modtime.Truncate(time.Second)
+
+	if value, exists := req.Headers.Get("If-Match"); exists {
+		if !matchesAny(value, etag, StrongMatch) {
+			return PRECONDITIONFAILED
+		}
+	} else if value, exists := req.Headers.Get("If-Unmodified-Since"); exists && !modtime.IsZero() {
+		if t, err := http.ParseTime(value); err == nil && modtime.After(t) {
+			return PRECONDITIONFAILED
+		}
+	}
+
+	if value, exists := req.Headers.Get("If-None-Match"); exists {
+		if matchesAny(value, etag, WeakMatch) {
+			if safe {
+				return NOTMODIFIED
+			}
+			return PRECONDITIONFAILED
+		}
+	} else if value, exists := req.Headers.Get("If-Modified-Since"); exists && safe && !modtime.IsZero() {
+		if t, err := http.ParseTime(value); err == nil && !modtime.After(t) {
+			return NOTMODIFIED
+		}
+	}
+
+	return OK
+}
+
+// WritePreconditionResult sends a bodiless 304 or 412. A 304 repeats the
+// validators so caches can refresh their stored response
+func WritePreconditionResult(w *Writer, statusCode StatusCode, etag string, modtime time.Time) error {
+	h := headers.NewHeaders()
+	h.Set("Connection", "close")
+	if statusCode == NOTMODIFIED {
+		if etag != "" {
+			h.Set("ETag", etag)
+		}
+		if !modtime.IsZero() {
+			h.Set("Last-Modified", modtime.UTC().Format(http.TimeFormat))
+		}
+	} else {
+		h.Set("Content-Length", "0")
+	}
+	if err := w.WriteStatusLine(statusCode); err != nil {
+		return err
+	}
+	return w.WriteHeaders(h)
+}
@@ -0,0 +1,69 @@
+package response_test
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"boot.httpserver/internal/response"
+	"boot.httpserver/internal/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestETags(t *testing.T) {
+	strong := response.StrongETag([]byte("hello"))
+	weak := response.WeakETag([]byte("hello"))
+	assert.Equal(t, "W/"+strong, weak)
+	assert.True(t, response.StrongMatch(strong, strong))
+	assert.False(t, response.StrongMatch(strong, weak))
+	assert.True(t, response.WeakMatch(strong, weak))
+	assert.Equal(t, []string{`"a,b"`, `W/"c"`, "*"}, response.ParseETags(`"a,b", W/"c" ,*`))
+}
+
+func TestEvaluatePreconditions(t *testing.T) {
+	etag := `"v1"`
+	modtime := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	before := modtime.Add(-time.Hour).Format(http.TimeFormat)
+	after := modtime.Add(time.Hour).Format(http.TimeFormat)
+
+	cases := []struct {
+		name   string
+		method string
+		h      map[string]string
+		want   response.StatusCode
+	}{
+		{"no conditions", "GET", nil, response.OK},
+		{"if-none-match hit", "GET", map[string]string{"if-none-match": `"v0", W/"v1"`}, response.NOTMODIFIED},
+		{"if-none-match star", "GET", map[string]string{"if-none-match": "*"}, response.NOTMODIFIED},
+		{"if-none-match miss", "GET", map[string]string{"if-none-match": `"v0"`}, response.OK},
+		{"if-none-match hit on unsafe method", "PUT", map[string]string{"if-none-match": `"v1"`}, response.PRECONDITIONFAILED},
+		{"if-modified-since not modified", "GET", map[string]string{"if-modified-since": after}, response.NOTMODIFIED},
+		{"if-modified-since modified", "GET", map[string]string{"if-modified-since": before}, response.OK},
+		{"if-modified-since ignored with if-none-match", "GET", map[string]string{"if-none-match": `"v0"`, "if-modified-since": after}, response.OK},
+		{"if-modified-since ignored for post", "POST", map[string]string{"if-modified-since": after}, response.OK},
+		{"if-match hit", "PUT", map[string]string{"if-match": `"v1"`}, response.OK},
+		{"if-match weak never matches", "PUT", map[string]string{"if-match": `W/"v1"`}, response.PRECONDITIONFAILED},
+		{"if-unmodified-since failed", "PUT", map[string]string{"if-unmodified-since": before}, response.PRECONDITIONFAILED},
+		{"if-unmodified-since ignored with if-match", "PUT", map[string]string{"if-match": "*", "if-unmodified-since": before}, response.OK},
+		{"invalid date ignored", "GET", map[string]string{"if-modified-since": "yesterday"}, response.OK},
+	}
+	for _, c := range cases {
+		got := response.EvaluatePreconditions(testutil.NewRequest(c.method, "/", c.h), etag, modtime)
+		assert.Equal(t, c.want, got, c.name)
+	}
+}
+
+func TestWritePreconditionResult(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := &response.Writer{Wrt: buf}
+	modtime := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	err := response.WritePreconditionResult(w, response.NOTMODIFIED, `"v1"`, modtime)
+	assert.NoError(t, err)
+	out := buf.String()
+	assert.Contains(t, out, "HTTP/1.1 304 Not Modified\r\n")
+	assert.Contains(t, out, "ETag: \"v1\"\r\n")
+	assert.Contains(t, out, "Last-Modified: Thu, 02 Jan 2025 03:04:05 GMT\r\n")
+	assert.NotContains(t, out, "Content-Length")
+	assert.True(t, bytes.HasSuffix(buf.Bytes(), []byte("\r\n\r\n")))
+}
@@ -0,0 +1,5 @@
+package response
+
+// ParseETags lets the tests outside the package, which need testutil and
+// so can't be inside it, check the list parser
+var ParseETags = parseETags
@@ -0,0 +1,71 @@
+package response
+
+import (
+	"encoding/json"
+	"maps"
+)
+
+// WriteJSON sends v as an application/json body. v is encoded before
+// anything is written so an unencodable value can still become a 500
+func WriteJSON(w *Writer, statusCode StatusCode, v any) error {
+	return writeJSON(w, statusCode, "application/json", v)
+}
+
+func writeJSON(w *Writer, statusCode StatusCode, contentType string, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	body = append(body, '\n')
+	w.Header().Set("Content-Type", contentType)
+	if err := w.WriteHeader(statusCode); err != nil {
+		return err
+	}
+	_, err = w.Write(body)
+	return err
+}
+
+// Problem is an RFC 9457 problem details object. Type defaults to
+// about:blank, in which case Title should be the status reason phrase.
+// Extensions are sent as additional members next to the standard ones
+type Problem struct {
+	Type       string
+	Title      string
+	Status     StatusCode
+	Detail     string
+	Instance   string
+	Extensions map[string]any
+}
+
+func (p Problem) MarshalJSON() ([]byte, error) {
+	m := make(map[string]any, len(p.Extensions)+5)
+	maps.Copy(m, p.Extensions)
+	if p.Type != "" {
+		m["type"] = p.Type
+	}
+	if p.Title != "" {
+		m["title"] = p.Title
+	}
+	if p.Status != 0 {
+		m["status"] = int(p.Status)
+	}
+	if p.Detail != "" {
+		m["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		m["instance"] = p.Instance
+	}
+	return json.Marshal(m)
+}
+
+// WriteProblem sends p as application/problem+json with p.Status as the
+// response status, filling in the title for about:blank problems
+func WriteProblem(w *Writer, p Problem) error {
+	if p.Status == 0 {
+		p.Status = INTERNALERROR
+	}
+	if p.Title == "" && (p.Type == "" || p.Type == "about:blank") {
+		p.Title = StatusText(p.Status)
+	}
+	return writeJSON(w, p.Status, "application/problem+json", p)
+}
@@ -0,0 +1,48 @@
+package response
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteJSON(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := &Writer{Wrt: buf}
+	require.NoError(t, WriteJSON(w, OK, map[string]string{"name": "ada"}))
+	require.NoError(t, w.Finish())
+
+	out := buf.String()
+	assert.Contains(t, out, "HTTP/1.1 200 OK\r\n")
+	assert.Contains(t, out, "Content-Type: application/json\r\n")
+	assert.Contains(t, out, "Content-Length: 15\r\n")
+	assert.Contains(t, out, "\r\n\r\n{\"name\":\"ada\"}\n")
+
+	// Test: encoding errors leave the response untouched
+	w = &Writer{Wrt: buf}
+	assert.Error(t, WriteJSON(w, OK, make(chan int)))
+	assert.Equal(t, WRITINGSTATUSLINE, w.WriterState)
+}
+
+func TestWriteProblem(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := &Writer{Wrt: buf}
+	require.NoError(t, WriteProblem(w, Problem{
+		Status:     NOTFOUND,
+		Detail:     "no user 42",
+		Extensions: map[string]any{"id": 42},
+	}))
+	require.NoError(t, w.Finish())
+
+	out := buf.String()
+	assert.Contains(t, out, "HTTP/1.1 404 Not Found\r\n")
+	assert.Contains(t, out, "Content-Type: application/problem+json\r\n")
+	assert.Contains(t, out, `{"detail":"no user 42","id":42,"status":404,"title":"Not Found"}`)
+}
+
+func TestStatusText(t *testing.T) {
+	assert.Equal(t, "Method Not Allowed", StatusText(METHODNOTALLOWED))
+	assert.Equal(t, "", StatusText(999))
+}
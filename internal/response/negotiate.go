@@ -0,0 +1,96 @@
+package response
+
+import (
+	"strings"
+
+	"boot.httpserver/internal/headers"
+)
+
+// Negotiate picks the offered media type the client prefers according to
+// its Accept header. Offers are listed in the server's order of
+// preference, which breaks ties, and the first one wins when the client
+// didn't say. NOTACCEPTABLE is returned when none of them is acceptable
+func Negotiate(h headers.Headers, offers []string) (string, StatusCode) {
+	accept, ok := h.Get("Accept")
+	if !ok || strings.TrimSpace(accept) == "" {
+		return first(offers)
+	}
+	ranges := headers.ParseAccept(accept)
+	return best(offers, func(offer string) float64 {
+		// the most specific range matching the offer decides its quality
+		q, specificity := 0.0, -1
+		for _, r := range ranges {
+			if r.Specificity() > specificity && r.Matches(offer) {
+				q, specificity = r.Q, r.Specificity()
+			}
+		}
+		return q
+	})
+}
+
+// NegotiateLanguage picks from offered language tags using
+// Accept-Language, where "en" also matches "en-GB"
+func NegotiateLanguage(h headers.Headers, offers []string) (string, StatusCode) {
+	accept, ok := h.Get("Accept-Language")
+	if !ok || strings.TrimSpace(accept) == "" {
+		return first(offers)
+	}
+	ranges := headers.ParseAcceptLanguage(accept)
+	return best(offers, func(offer string) float64 {
+		tag := strings.ToLower(offer)
+		q, longest := 0.0, -1
+		for _, r := range ranges {
+			matches := r.Value == "*" || r.Value == tag || strings.HasPrefix(tag, r.Value+"-")
+			specificity := len(r.Value)
+			if r.Value == "*" {
+				specificity = 0
+			}
+			if matches && specificity > longest {
+				q, longest = r.Q, specificity
+			}
+		}
+		return q
+	})
+}
+
+// NegotiateCharset picks from offered charsets using Accept-Charset
+func NegotiateCharset(h headers.Headers, offers []string) (string, StatusCode) {
+	accept, ok := h.Get("Accept-Charset")
+	if !ok || strings.TrimSpace(accept) == "" {
+		return first(offers)
+	}
+	ranges := headers.ParseAcceptCharset(accept)
+	return best(offers, func(offer string) float64 {
+		charset := strings.ToLower(offer)
+		q, exact := 0.0, false
+		for _, r := range ranges {
+			if r.Value == charset && !exact {
+				q, exact = r.Q, true
+			} else if r.Value == "*" && !exact && q == 0 {
+				q = r.Q
+			}
+		}
+		return q
+	})
+}
+
+func first(offers []string) (string, StatusCode) {
+	if len(offers) == 0 {
+		return "", NOTACCEPTABLE
+	}
+	return offers[0], OK
+}
+
+// best returns the first offer with the highest non-zero quality
+func best(offers []string, quality func(offer string) float64) (string, StatusCode) {
+	bestOffer, bestQ := "", 0.0
+	for _, offer := range offers {
+		if q := quality(offer); q > bestQ {
+			bestOffer, bestQ = offer, q
+		}
+	}
+	if bestQ == 0 {
+		return "", NOTACCEPTABLE
+	}
+	return bestOffer, OK
+}
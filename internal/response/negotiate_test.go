@@ -0,0 +1,71 @@
+package response
+
+import (
+	"testing"
+
+	"boot.httpserver/internal/headers"
+	"github.com/stretchr/testify/assert"
+)
+
+func acceptHeaders(name, value string) headers.Headers {
+	h := headers.NewHeaders()
+	if value != "" {
+		h.Set(name, value)
+	}
+	return h
+}
+
+func TestNegotiate(t *testing.T) {
+	offers := []string{"text/html", "application/json", "text/plain"}
+	cases := []struct {
+		accept string
+		want   string
+		status StatusCode
+	}{
+		{"", "text/html", OK},
+		{"*/*", "text/html", OK},
+		{"application/json", "application/json", OK},
+		{"text/plain, application/json;q=0.9", "text/plain", OK},
+		// the most specific range wins, even with a lower q
+		{"text/*, text/html;q=0.1", "text/plain", OK},
+		{"*/*;q=0.2, application/*;q=0.5", "application/json", OK},
+		{"text/*;q=0, */*", "application/json", OK},
+		{"image/png", "", NOTACCEPTABLE},
+		{"text/html;q=0", "", NOTACCEPTABLE},
+	}
+	for _, c := range cases {
+		got, status := Negotiate(acceptHeaders("Accept", c.accept), offers)
+		assert.Equal(t, c.want, got, c.accept)
+		assert.Equal(t, c.status, status, c.accept)
+	}
+}
+
+func TestNegotiateLanguage(t *testing.T) {
+	offers := []string{"en-US", "fr", "de-CH"}
+	cases := map[string]string{
+		"":                    "en-US",
+		"fr, en;q=0.8":        "fr",
+		"de":                  "de-CH",
+		"en-GB, *;q=0.5":      "en-US",
+		"es, *;q=0.1, fr;q=0": "en-US",
+		"ja":                  "",
+	}
+	for accept, want := range cases {
+		got, _ := NegotiateLanguage(acceptHeaders("Accept-Language", accept), offers)
+		assert.Equal(t, want, got, accept)
+	}
+}
+
+func TestNegotiateCharset(t *testing.T) {
+	offers := []string{"utf-8", "iso-8859-1"}
+	cases := map[string]string{
+		"":                        "utf-8",
+		"ISO-8859-1, utf-8;q=0.5": "iso-8859-1",
+		"*;q=0.5, utf-8;q=0":      "iso-8859-1",
+		"us-ascii":                "",
+	}
+	for accept, want := range cases {
+		got, _ := NegotiateCharset(acceptHeaders("Accept-Charset", accept), offers)
+		assert.Equal(t, want, got, accept)
+	}
+}
@@ -3,6 +3,7 @@ package response
 import (
 	"io"
 	"strconv"
+	"strings"
 
 	"boot.httpserver/internal/headers"
 )
@@ -10,24 +11,57 @@ import (
 type StatusCode int
 
 const (
-	OK            StatusCode = 200
-	BADREQUEST               = 400
-	INTERNALERROR            = 500
+	SWITCHINGPROTOCOLS   StatusCode = 101
+	OK                   StatusCode = 200
+	NOCONTENT                       = 204
+	PARTIALCONTENT                  = 206
+	MOVEDPERMANENTLY                = 301
+	NOTMODIFIED                     = 304
+	BADREQUEST                      = 400
+	UNAUTHORIZED                    = 401
+	FORBIDDEN                       = 403
+	NOTFOUND                        = 404
+	METHODNOTALLOWED                = 405
+	NOTACCEPTABLE                   = 406
+	PRECONDITIONFAILED              = 412
+	CONTENTTOOLARGE                 = 413
+	UNSUPPORTEDMEDIATYPE            = 415
+	RANGENOTSATISFIABLE             = 416
+	MISDIRECTEDREQUEST              = 421
+	UPGRADEREQUIRED                 = 426
+	TOOMANYREQUESTS                 = 429
+	INTERNALERROR                   = 500
+	BADGATEWAY                      = 502
+	SERVICEUNAVAILABLE              = 503
 )
 
 var responses = map[StatusCode]string{
-	OK:            "HTTP/1.1 200 OK\r\n",
-	BADREQUEST:    "HTTP/1.1 400 Bad Request\r\n",
-	INTERNALERROR: "HTTP/1.1 500 Internal Server Error\r\n",
+	SWITCHINGPROTOCOLS:   "HTTP/1.1 101 Switching Protocols\r\n",
+	OK:                   "HTTP/1.1 200 OK\r\n",
+	NOCONTENT:            "HTTP/1.1 204 No Content\r\n",
+	PARTIALCONTENT:       "HTTP/1.1 206 Partial Content\r\n",
+	MOVEDPERMANENTLY:     "HTTP/1.1 301 Moved Permanently\r\n",
+	NOTMODIFIED:          "HTTP/1.1 304 Not Modified\r\n",
+	BADREQUEST:           "HTTP/1.1 400 Bad Request\r\n",
+	UNAUTHORIZED:         "HTTP/1.1 401 Unauthorized\r\n",
+	FORBIDDEN:            "HTTP/1.1 403 Forbidden\r\n",
+	NOTFOUND:             "HTTP/1.1 404 Not Found\r\n",
+	METHODNOTALLOWED:     "HTTP/1.1 405 Method Not Allowed\r\n",
+	NOTACCEPTABLE:        "HTTP/1.1 406 Not Acceptable\r\n",
+	PRECONDITIONFAILED:   "HTTP/1.1 412 Precondition Failed\r\n",
+	CONTENTTOOLARGE:      "HTTP/1.1 413 Content Too Large\r\n",
+	UNSUPPORTEDMEDIATYPE: "HTTP/1.1 415 Unsupported Media Type\r\n",
+	RANGENOTSATISFIABLE:  "HTTP/1.1 416 Range Not Satisfiable\r\n",
+	MISDIRECTEDREQUEST:   "HTTP/1.1 421 Misdirected Request\r\n",
+	UPGRADEREQUIRED:      "HTTP/1.1 426 Upgrade Required\r\n",
+	TOOMANYREQUESTS:      "HTTP/1.1 429 Too Many Requests\r\n",
+	INTERNALERROR:        "HTTP/1.1 500 Internal Server Error\r\n",
+	BADGATEWAY:           "HTTP/1.1 502 Bad Gateway\r\n",
+	SERVICEUNAVAILABLE:   "HTTP/1.1 503 Service Unavailable\r\n",
 }
 
 func WriteStatus(w io.Writer, status StatusCode) error {
-	response, ok := responses[status]
-	if !ok {
-		response = ""
-	}
-
-	_, err := w.Write([]byte(response))
+	_, err := w.Write([]byte(statusLine(status)))
 
 	if err != nil {
 		return err
@@ -37,9 +71,17 @@ func WriteStatus(w io.Writer, status StatusCode) error {
 }
 
 func GetDefaultHeaders(contentLength int) headers.Headers {
-	h := make(map[string]string)
+	h := DefaultHeaders()
 
 	h["Content-Length"] = strconv.Itoa(contentLength)
+
+	return h
+}
+
+// DefaultHeaders leaves out Content-Length so the Writer picks the framing
+func DefaultHeaders() headers.Headers {
+	h := make(map[string]string)
+
 	h["Connection"] = "close"
 	h["Content-Type"] = "text/plain"
 
@@ -63,3 +105,27 @@ func WriteHeaders(w io.Writer, headers headers.Headers) error {
 
 	return nil
 }
+
+// statusLine falls back to an empty reason phrase, which RFC 9112 allows,
+// for codes without a constant, such as those relayed from upstreams
+func statusLine(statusCode StatusCode) string {
+	if line, ok := responses[statusCode]; ok {
+		return line
+	}
+	return "HTTP/1.1 " + strconv.Itoa(int(statusCode)) + " \r\n"
+}
+
+// StatusText returns the reason phrase for statusCode, or "" if unknown
+func StatusText(statusCode StatusCode) string {
+	line, ok := responses[statusCode]
+	if !ok {
+		return ""
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	// "HTTP/1.1 200 OK"
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) < 3 {
+		return ""
+	}
+	return parts[2]
+}
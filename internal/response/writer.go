@@ -1,55 +1,196 @@
 package response
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"net"
+	"strconv"
+	"strings"
 
 	"boot.httpserver/internal/headers"
 )
 
+var (
+	ErrHijacked      = errors.New("connection has been hijacked")
+	ErrNotHijackable = errors.New("writer has no connection to hijack")
+)
+
 type WriterStatus int
 
 const (
 	WRITINGSTATUSLINE WriterStatus = iota
 	WRITINGHEADERS
 	WRITINGBODY
+	WRITINGTRAILERS
+	DONE
 )
 
+// fields that may never be sent as trailers (RFC 9110 6.5.1)
+var forbiddenTrailers = map[string]bool{
+	"authorization":      true,
+	"cache-control":      true,
+	"content-encoding":   true,
+	"content-length":     true,
+	"content-range":      true,
+	"content-type":       true,
+	"expect":             true,
+	"host":               true,
+	"max-forwards":       true,
+	"proxy-authenticate": true,
+	"set-cookie":         true,
+	"te":                 true,
+	"trailer":            true,
+	"transfer-encoding":  true,
+	"www-authenticate":   true,
+}
+
+// A Filter sees the status code and headers right before they are sent
+// and may rewrite them. Returning a non-nil writer makes every body byte
+// go through it; it is closed when the body is finished
+type Filter func(statusCode StatusCode, h headers.Headers, body io.Writer) io.WriteCloser
+
+// bodies up to this size are held back so Content-Length can be set;
+// anything larger is sent chunked
+const autoBufferSize = 8 << 10
+
 type Writer struct {
 	Wrt         io.Writer
 	WriterState WriterStatus
+	Conn        net.Conn
+	// bytes the server read from Conn past the end of the request
+	Buffered []byte
+	// method of the request being answered; HEAD responses carry no body
+	Method string
+
+	statusCode    StatusCode
+	handlerHeader headers.Headers
+	header        headers.Headers
+	filters       []Filter
+	body          io.Writer
+	closers       []io.Closer
+	committed     bool
+	pending       []byte
+	discarded     int
+	chunked       bool
+	trailers      map[string]bool
+	hijacked      bool
+}
+
+func (w *Writer) AddFilter(f Filter) {
+	w.filters = append(w.filters, f)
+}
+
+// Hijack hands the raw connection to the caller, together with any bytes
+// already read from it past the request that must be consumed before
+// reading from the connection. The caller becomes responsible for closing
+// it and the Writer can no longer be used. It must be called before
+// anything has been written
+func (w *Writer) Hijack() (net.Conn, []byte, error) {
+	if w.hijacked {
+		return nil, nil, ErrHijacked
+	}
+	if w.Conn == nil {
+		return nil, nil, ErrNotHijackable
+	}
+	if w.WriterState != WRITINGSTATUSLINE {
+		return nil, nil, errors.New("cannot hijack after the response has started")
+	}
+	w.hijacked = true
+	buffered := w.Buffered
+	w.Buffered = nil
+	return w.Conn, buffered, nil
+}
+
+func (w *Writer) Hijacked() bool {
+	return w.hijacked
+}
+
+// Status returns the status code written so far, 0 if none
+func (w *Writer) Status() StatusCode {
+	return w.statusCode
+}
+
+// Header returns the headers that WriteHeader or the first Write will
+// send. Changes made once they have gone out have no effect
+func (w *Writer) Header() headers.Headers {
+	if w.WriterState >= WRITINGBODY {
+		return maps.Clone(w.header)
+	}
+	if w.handlerHeader == nil {
+		w.handlerHeader = headers.NewHeaders()
+	}
+	return w.handlerHeader
+}
+
+// WriteHeader sends the status line along with the headers from Header,
+// filling in the defaults the handler didn't set
+func (w *Writer) WriteHeader(statusCode StatusCode) error {
+	if err := w.WriteStatusLine(statusCode); err != nil {
+		return err
+	}
+	h := w.Header()
+	for key, value := range DefaultHeaders() {
+		if _, ok := h.Get(key); !ok {
+			h.Set(key, value)
+		}
+	}
+	return w.WriteHeaders(h)
+}
+
+// Write sends p as part of the body, sending a 200 first if the handler
+// hasn't written a status yet
+func (w *Writer) Write(p []byte) (int, error) {
+	switch w.WriterState {
+	case WRITINGSTATUSLINE:
+		if err := w.WriteHeader(OK); err != nil {
+			return 0, err
+		}
+	case WRITINGHEADERS:
+		if err := w.WriteHeaders(w.Header()); err != nil {
+			return 0, err
+		}
+	}
+	return w.WriteBody(p)
 }
 
 func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
+	if w.hijacked {
+		return ErrHijacked
+	}
 	if w.WriterState != WRITINGSTATUSLINE {
 		return fmt.Errorf("cannot write status line in state %d", w.WriterState)
 	}
 	defer func() { w.WriterState = WRITINGHEADERS }()
-	response, ok := responses[statusCode]
-	if !ok {
-		response = ""
-	}
-	_, err := w.Wrt.Write([]byte(response))
+	w.statusCode = statusCode
+	_, err := w.Wrt.Write([]byte(statusLine(statusCode)))
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// WriteHeaders sends headers, unless they leave the framing open: with
+// neither Content-Length nor Transfer-Encoding the body is buffered and
+// the headers go out once its size is known or it outgrows the buffer
 func (w *Writer) WriteHeaders(headers headers.Headers) error {
 	if w.WriterState != WRITINGHEADERS {
 		return fmt.Errorf("cannot write headers in state %d", w.WriterState)
 	}
 	defer func() { w.WriterState = WRITINGBODY }()
-	for k, v := range headers {
-		_, err := w.Wrt.Write([]byte(k + ": " + v + "\r\n"))
-		if err != nil {
-			return err
+
+	// keep whatever was set through Header unless overridden here
+	for key, value := range w.handlerHeader {
+		if _, ok := headers.Get(key); !ok {
+			headers.Set(key, value)
 		}
 	}
-	_, err := w.Wrt.Write([]byte("\r\n"))
-	if err != nil {
-		return err
+	w.header = headers
+	_, hasLength := headers.Get("Content-Length")
+	_, hasEncoding := headers.Get("Transfer-Encoding")
+	if hasLength || hasEncoding || (w.bodyless() && !w.isHead()) {
+		return w.commit()
 	}
 	return nil
 }
@@ -58,40 +199,82 @@ func (w *Writer) WriteBody(p []byte) (int, error) {
 	if w.WriterState != WRITINGBODY {
 		return 0, fmt.Errorf("cannot write body in state %d", w.WriterState)
 	}
-	n, err := w.Wrt.Write(p)
+	if w.bodyless() {
+		w.discarded += len(p)
+		return len(p), nil
+	}
+	if !w.committed {
+		w.pending = append(w.pending, p...)
+		if len(w.pending) <= autoBufferSize {
+			return len(p), nil
+		}
+		w.header.Set("Transfer-Encoding", "chunked")
+		if err := w.commit(); err != nil {
+			return 0, err
+		}
+		if err := w.writePending(); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	n, err := w.body.Write(p)
 	if err != nil {
 		return n, err
 	}
 	return n, nil
 }
 
+// WriteChunkedBody sends p as one chunk of a response that declared
+// Transfer-Encoding: chunked. Empty slices are skipped since a zero-length
+// chunk is what terminates the body
 func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
 	if w.WriterState != WRITINGBODY {
 		return 0, fmt.Errorf("cannot write body in state %d", w.WriterState)
 	}
-
-	chunkHeader := fmt.Sprintf("%x\r\n", len(p))
-	if _, err := io.WriteString(w.Wrt, chunkHeader); err != nil {
-		return 0, err
+	if !w.chunked {
+		return 0, errors.New("response is not chunked")
 	}
-
-	if _, err := w.Wrt.Write(p); err != nil {
-		return 0, err
-	}
-
-	if _, err := io.WriteString(w.Wrt, "\r\n"); err != nil {
-		return 0, err
+	if w.bodyless() {
+		return len(p), nil
 	}
-
-	return len(p), nil
+	return w.body.Write(p)
 }
 
+// WriteChunkedBodyDone writes the last chunk; WriteTrailers must follow,
+// or Finish will end the message without trailers
 func (w *Writer) WriteChunkedBodyDone() (int, error) {
+	if w.WriterState != WRITINGBODY {
+		return 0, fmt.Errorf("cannot end body in state %d", w.WriterState)
+	}
+	if !w.chunked {
+		return 0, errors.New("response is not chunked")
+	}
+	if err := w.closeFilters(); err != nil {
+		return 0, err
+	}
+	w.WriterState = WRITINGTRAILERS
+	if w.bodyless() {
+		return 0, nil
+	}
 	return w.Wrt.Write([]byte("0\r\n"))
 }
 
+// WriteTrailers ends a chunked message. Only fields announced in the
+// Trailer header are sent; anything else, and fields that are never
+// allowed in trailers, is dropped
 func (w *Writer) WriteTrailers(h headers.Headers) error {
+	if w.WriterState != WRITINGTRAILERS {
+		return fmt.Errorf("cannot write trailers in state %d", w.WriterState)
+	}
+	defer func() { w.WriterState = DONE }()
+	if w.bodyless() {
+		return nil
+	}
 	for key, value := range h {
+		lower := strings.ToLower(key)
+		if !w.trailers[lower] || forbiddenTrailers[lower] {
+			continue
+		}
 		_, err := io.WriteString(w.Wrt, key+": "+value+"\r\n")
 		if err != nil {
 			return err
@@ -100,3 +283,189 @@ func (w *Writer) WriteTrailers(h headers.Headers) error {
 	_, err := io.WriteString(w.Wrt, "\r\n")
 	return err
 }
+
+type flusher interface {
+	Flush() error
+}
+
+// Flush pushes anything buffered by filters or by Wrt out to the client,
+// so streamed bodies don't sit in memory until the handler returns. A
+// body still being buffered is switched to chunked encoding
+func (w *Writer) Flush() error {
+	if w.hijacked {
+		return ErrHijacked
+	}
+	if w.WriterState == WRITINGBODY && !w.committed && !w.bodyless() {
+		w.header.Set("Transfer-Encoding", "chunked")
+		if err := w.commit(); err != nil {
+			return err
+		}
+		if err := w.writePending(); err != nil {
+			return err
+		}
+	}
+	for i := len(w.closers) - 1; i >= 0; i-- {
+		if f, ok := w.closers[i].(flusher); ok {
+			if err := f.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if f, ok := w.Wrt.(flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Finish completes whatever the handler left open: buffered bodies are
+// sent with their Content-Length, filters are flushed and a chunked body
+// gets its last chunk and empty trailer section. The server calls it once
+// the handler returns; calling it again is a no-op
+func (w *Writer) Finish() error {
+	if w.hijacked {
+		return nil
+	}
+	switch w.WriterState {
+	case WRITINGBODY:
+		if !w.committed {
+			length := len(w.pending)
+			if w.isHead() {
+				length = w.discarded
+			}
+			if w.statusCode != NOTMODIFIED {
+				w.header.Set("Content-Length", strconv.Itoa(length))
+			}
+			if err := w.commit(); err != nil {
+				return err
+			}
+			if err := w.writePending(); err != nil {
+				return err
+			}
+		}
+		if err := w.closeFilters(); err != nil {
+			return err
+		}
+		w.WriterState = DONE
+		if !w.chunked || w.bodyless() {
+			return nil
+		}
+		_, err := io.WriteString(w.Wrt, "0\r\n\r\n")
+		return err
+	case WRITINGTRAILERS:
+		w.WriterState = DONE
+		if w.bodyless() {
+			return nil
+		}
+		_, err := io.WriteString(w.Wrt, "\r\n")
+		return err
+	}
+	return nil
+}
+
+// commit runs the filters over the final headers and writes them
+func (w *Writer) commit() error {
+	w.committed = true
+	h := w.header
+
+	// the first filter added sits closest to the connection
+	w.body = &rawBody{w: w}
+	for _, filter := range w.filters {
+		if wc := filter(w.statusCode, h, w.body); wc != nil {
+			w.body = wc
+			w.closers = append(w.closers, wc)
+		}
+	}
+	if te, ok := h.Get("Transfer-Encoding"); ok && strings.Contains(strings.ToLower(te), "chunked") {
+		w.chunked = true
+	}
+	w.trailers = map[string]bool{}
+	if declared, ok := h.Get("Trailer"); ok {
+		for _, name := range strings.Split(declared, ",") {
+			w.trailers[strings.ToLower(strings.TrimSpace(name))] = true
+		}
+	}
+	// these statuses never have content, so no framing either
+	if w.statusCode == NOCONTENT || w.statusCode < 200 {
+		h.Delete("Content-Length")
+		h.Delete("Transfer-Encoding")
+	}
+
+	for k, v := range h {
+		_, err := w.Wrt.Write([]byte(k + ": " + v + "\r\n"))
+		if err != nil {
+			return err
+		}
+	}
+	_, err := w.Wrt.Write([]byte("\r\n"))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (w *Writer) writePending() error {
+	pending := w.pending
+	w.pending = nil
+	if w.bodyless() || len(pending) == 0 {
+		return nil
+	}
+	_, err := w.body.Write(pending)
+	return err
+}
+
+func (w *Writer) isHead() bool {
+	return w.Method == "HEAD"
+}
+
+// bodyless reports whether the response must not carry content
+func (w *Writer) bodyless() bool {
+	return w.isHead() || w.statusCode == NOCONTENT || w.statusCode == NOTMODIFIED || w.statusCode < 200
+}
+
+func (w *Writer) closeFilters() error {
+	// innermost first so each filter flushes into the one below it
+	for i := len(w.closers) - 1; i >= 0; i-- {
+		if err := w.closers[i].Close(); err != nil {
+			return err
+		}
+	}
+	w.closers = nil
+	return nil
+}
+
+// rawBody is the bottom of the filter chain, framing bytes as chunks when
+// the response declared Transfer-Encoding: chunked
+type rawBody struct {
+	w *Writer
+}
+
+func (b *rawBody) Write(p []byte) (int, error) {
+	if b.w.bodyless() {
+		return len(p), nil
+	}
+	if !b.w.chunked {
+		return b.w.Wrt.Write(p)
+	}
+	// an empty chunk would terminate the body
+	if len(p) == 0 {
+		return 0, nil
+	}
+	return writeChunk(b.w.Wrt, p)
+}
+
+func writeChunk(wrt io.Writer, p []byte) (int, error) {
+	chunkHeader := fmt.Sprintf("%x\r\n", len(p))
+	if _, err := io.WriteString(wrt, chunkHeader); err != nil {
+		return 0, err
+	}
+
+	if _, err := wrt.Write(p); err != nil {
+		return 0, err
+	}
+
+	if _, err := io.WriteString(wrt, "\r\n"); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
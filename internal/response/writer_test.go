@@ -0,0 +1,234 @@
+package response
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"boot.httpserver/internal/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func chunkedWriter(t *testing.T, trailer string) (*Writer, *bytes.Buffer) {
+	buf := &bytes.Buffer{}
+	w := &Writer{Wrt: buf}
+	h := headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	if trailer != "" {
+		h.Set("Trailer", trailer)
+	}
+	require.NoError(t, w.WriteStatusLine(OK))
+	require.NoError(t, w.WriteHeaders(h))
+	buf.Reset()
+	return w, buf
+}
+
+func TestChunkedBody(t *testing.T) {
+	// Test: empty chunks don't end the body early
+	w, buf := chunkedWriter(t, "")
+	_, err := w.WriteChunkedBody([]byte("hello"))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBody(nil)
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBody([]byte(" world"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "5\r\nhello\r\n6\r\n world\r\n0\r\n\r\n", buf.String())
+	assert.Equal(t, DONE, w.WriterState)
+
+	// Test: Finish is idempotent
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "5\r\nhello\r\n6\r\n world\r\n0\r\n\r\n", buf.String())
+
+	// Test: nothing can be written once done
+	_, err = w.WriteChunkedBody([]byte("late"))
+	assert.Error(t, err)
+	_, err = w.WriteBody([]byte("late"))
+	assert.Error(t, err)
+}
+
+func TestTrailers(t *testing.T) {
+	w, buf := chunkedWriter(t, "X-Checksum, Content-Length")
+	_, err := w.WriteChunkedBody([]byte("data"))
+	require.NoError(t, err)
+
+	// Test: trailers before the last chunk are refused
+	assert.Error(t, w.WriteTrailers(headers.Headers{"X-Checksum": "abc"}))
+
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBody([]byte("late"))
+	assert.Error(t, err)
+
+	// Test: undeclared and forbidden trailers are dropped
+	err = w.WriteTrailers(headers.Headers{
+		"X-Checksum":     "abc",
+		"X-Undeclared":   "nope",
+		"Content-Length": "4",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "4\r\ndata\r\n0\r\nX-Checksum: abc\r\n\r\n", buf.String())
+
+	// Test: trailers only once
+	assert.Error(t, w.WriteTrailers(headers.Headers{"X-Checksum": "abc"}))
+}
+
+func TestFinishAfterBodyDone(t *testing.T) {
+	// Test: a handler that forgets WriteTrailers still ends the message
+	w, buf := chunkedWriter(t, "X-Checksum")
+	_, err := w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "0\r\n\r\n", buf.String())
+}
+
+func TestChunkedBodyRequiresChunkedResponse(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := &Writer{Wrt: buf}
+	require.NoError(t, w.WriteStatusLine(OK))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(4)))
+	_, err := w.WriteChunkedBody([]byte("data"))
+	assert.Error(t, err)
+	_, err = w.WriteChunkedBodyDone()
+	assert.Error(t, err)
+}
+
+func TestAutomaticContentLength(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := &Writer{Wrt: buf, Method: "GET"}
+	require.NoError(t, w.WriteStatusLine(OK))
+	require.NoError(t, w.WriteHeaders(headers.Headers{"Content-Type": "text/plain"}))
+	_, err := w.WriteBody([]byte("hello "))
+	require.NoError(t, err)
+	_, err = w.WriteBody([]byte("world"))
+	require.NoError(t, err)
+
+	// Test: nothing goes out until the size is known
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", buf.String())
+
+	require.NoError(t, w.Finish())
+	assert.Contains(t, buf.String(), "Content-Length: 11\r\n")
+	assert.True(t, bytes.HasSuffix(buf.Bytes(), []byte("\r\n\r\nhello world")))
+}
+
+func TestAutomaticChunking(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := &Writer{Wrt: buf, Method: "GET"}
+	require.NoError(t, w.WriteStatusLine(OK))
+	require.NoError(t, w.WriteHeaders(headers.Headers{"Content-Type": "text/plain"}))
+
+	big := bytes.Repeat([]byte("x"), autoBufferSize+1)
+	_, err := w.WriteBody(big)
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "Transfer-Encoding: chunked\r\n")
+	assert.NotContains(t, buf.String(), "Content-Length")
+
+	_, err = w.WriteBody([]byte("tail"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.True(t, bytes.HasSuffix(buf.Bytes(), []byte("4\r\ntail\r\n0\r\n\r\n")))
+}
+
+func TestBodylessResponses(t *testing.T) {
+	// Test: HEAD keeps the Content-Length a GET would have had
+	buf := &bytes.Buffer{}
+	w := &Writer{Wrt: buf, Method: "HEAD"}
+	require.NoError(t, w.WriteStatusLine(OK))
+	require.NoError(t, w.WriteHeaders(headers.Headers{"Content-Type": "text/plain"}))
+	_, err := w.WriteBody([]byte("hello world"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Contains(t, buf.String(), "Content-Length: 11\r\n")
+	assert.True(t, bytes.HasSuffix(buf.Bytes(), []byte("\r\n\r\n")))
+	assert.NotContains(t, buf.String(), "hello")
+
+	// Test: HEAD on a chunked response
+	buf = &bytes.Buffer{}
+	w = &Writer{Wrt: buf, Method: "HEAD"}
+	require.NoError(t, w.WriteStatusLine(OK))
+	require.NoError(t, w.WriteHeaders(headers.Headers{"Transfer-Encoding": "chunked"}))
+	_, err = w.WriteChunkedBody([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n", buf.String())
+
+	// Test: 204 drops the body and any framing
+	buf = &bytes.Buffer{}
+	w = &Writer{Wrt: buf, Method: "DELETE"}
+	require.NoError(t, w.WriteStatusLine(NOCONTENT))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	_, err = w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.NotContains(t, buf.String(), "Content-Length")
+	assert.True(t, bytes.HasSuffix(buf.Bytes(), []byte("\r\n\r\n")))
+
+	// Test: 304 drops the body
+	buf = &bytes.Buffer{}
+	w = &Writer{Wrt: buf, Method: "GET"}
+	require.NoError(t, w.WriteStatusLine(NOTMODIFIED))
+	require.NoError(t, w.WriteHeaders(headers.Headers{"ETag": `"v1"`}))
+	_, err = w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 304 Not Modified\r\nETag: \"v1\"\r\n\r\n", buf.String())
+}
+
+func TestImplicitHeader(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := &Writer{Wrt: buf}
+	w.Header().Set("Content-Type", "application/json")
+	require.NoError(t, json.NewEncoder(w).Encode(map[string]int{"n": 1}))
+	// Test: headers are frozen once sent
+	w.Header().Set("X-Late", "1")
+	require.NoError(t, w.Finish())
+
+	out := buf.String()
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, out, "Content-Type: application/json\r\n")
+	assert.Contains(t, out, "Connection: close\r\n")
+	assert.Contains(t, out, "Content-Length: 8\r\n")
+	assert.NotContains(t, out, "X-Late")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\n{\"n\":1}\n"))
+}
+
+func TestWriteHeader(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := &Writer{Wrt: buf}
+	w.Header().Set("Location", "/elsewhere")
+	require.NoError(t, w.WriteHeader(MOVEDPERMANENTLY))
+	_, err := io.Copy(w, strings.NewReader("moved"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+
+	out := buf.String()
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 301 Moved Permanently\r\n"))
+	assert.Contains(t, out, "Location: /elsewhere\r\n")
+	assert.Contains(t, out, "Content-Length: 5\r\n")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\nmoved"))
+
+	// Test: status can only be written once
+	assert.Error(t, w.WriteHeader(OK))
+
+	// Test: codes without a constant still get a status line
+	buf.Reset()
+	w = &Writer{Wrt: buf}
+	require.NoError(t, w.WriteHeader(StatusCode(418)))
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 418 \r\n"))
+}
+
+func TestHeaderMergedIntoWriteHeaders(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := &Writer{Wrt: buf}
+	w.Header().Set("Vary", "Origin")
+	w.Header().Set("Content-Type", "text/html")
+	require.NoError(t, w.WriteStatusLine(OK))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(0)))
+
+	out := buf.String()
+	assert.Contains(t, out, "Vary: Origin\r\n")
+	assert.Contains(t, out, "Content-Type: text/plain\r\n")
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"strings"
+
+	"boot.httpserver/internal/request"
+	"boot.httpserver/internal/response"
+)
+
+// HostMux dispatches on the Host header. A pattern is either an exact name
+// such as "example.com" or a wildcard such as "*.example.com", which
+// matches any subdomain at any depth but not example.com itself. Exact
+// names beat wildcards and longer wildcards beat shorter ones; hosts
+// nothing matches go to the default handler, or get a 421 without one
+type HostMux struct {
+	exact     map[string]Handler
+	wildcards map[string]Handler // keyed by suffix, e.g. ".example.com"
+	fallback  Handler
+}
+
+func NewHostMux() *HostMux {
+	return &HostMux{
+		exact:     map[string]Handler{},
+		wildcards: map[string]Handler{},
+	}
+}
+
+// CanonicalHost is the form HostMux compares names in: lowercase and
+// without a trailing dot
+func CanonicalHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// Handle registers handler for pattern; registering a pattern again
+// replaces its handler
+func (m *HostMux) Handle(pattern string, handler Handler) {
+	pattern = CanonicalHost(pattern)
+	if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+		m.wildcards[suffix] = handler
+		return
+	}
+	m.exact[pattern] = handler
+}
+
+// HandleDefault sets the handler for hosts no pattern matches
+func (m *HostMux) HandleDefault(handler Handler) {
+	m.fallback = handler
+}
+
+func (m *HostMux) ServeRequest(w *response.Writer, req *request.Request) {
+	if h := m.match(req.Host()); h != nil {
+		h(w, req)
+		return
+	}
+	WriteError(w, req, response.MISDIRECTEDREQUEST, "unknown host")
+}
+
+func (m *HostMux) match(host string) Handler {
+	if h, ok := m.exact[host]; ok {
+		return h
+	}
+	// try ".b.example.com", then ".example.com", then ".com"
+	for i := strings.IndexByte(host, '.'); i != -1; {
+		if h, ok := m.wildcards[host[i:]]; ok {
+			return h
+		}
+		next := strings.IndexByte(host[i+1:], '.')
+		if next == -1 {
+			break
+		}
+		i += next + 1
+	}
+	return m.fallback
+}
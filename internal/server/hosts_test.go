@@ -0,0 +1,53 @@
+package server
+
+import (
+	"bytes"
+	"testing"
+
+	"boot.httpserver/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostMux(t *testing.T) {
+	m := NewHostMux()
+	m.Handle("example.com", textHandler("apex"))
+	m.Handle("API.example.com", textHandler("api"))
+	m.Handle("*.example.com", textHandler("sub"))
+	m.Handle("*.eu.example.com", textHandler("eu"))
+
+	// Test: exact names ignore case, port and a trailing dot
+	assert.Contains(t, testutil.Serve(m.ServeRequest, testutil.NewRequest("GET", "/", map[string]string{"host": "example.com"})), "\r\n\r\napex")
+	assert.Contains(t, testutil.Serve(m.ServeRequest, testutil.NewRequest("GET", "/", map[string]string{"host": "Example.COM:8080"})), "\r\n\r\napex")
+	assert.Contains(t, testutil.Serve(m.ServeRequest, testutil.NewRequest("GET", "/", map[string]string{"host": "api.example.com."})), "\r\n\r\napi")
+
+	// Test: wildcards match any depth and the longest one wins
+	assert.Contains(t, testutil.Serve(m.ServeRequest, testutil.NewRequest("GET", "/", map[string]string{"host": "www.example.com"})), "\r\n\r\nsub")
+	assert.Contains(t, testutil.Serve(m.ServeRequest, testutil.NewRequest("GET", "/", map[string]string{"host": "a.b.example.com"})), "\r\n\r\nsub")
+	assert.Contains(t, testutil.Serve(m.ServeRequest, testutil.NewRequest("GET", "/", map[string]string{"host": "shop.eu.example.com"})), "\r\n\r\neu")
+	assert.Contains(t, testutil.Serve(m.ServeRequest, testutil.NewRequest("GET", "/", map[string]string{"host": "eu.example.com"})), "\r\n\r\nsub")
+
+	// Test: no match and no default
+	assert.Contains(t, testutil.Serve(m.ServeRequest, testutil.NewRequest("GET", "/", map[string]string{"host": "example.org"})), "HTTP/1.1 421 Misdirected Request\r\n")
+	assert.Contains(t, testutil.Serve(m.ServeRequest, testutil.NewRequest("GET", "/", map[string]string{"host": "badexample.com"})), "HTTP/1.1 421 Misdirected Request\r\n")
+
+	// Test: the default catches everything else
+	m.HandleDefault(textHandler("default"))
+	assert.Contains(t, testutil.Serve(m.ServeRequest, testutil.NewRequest("GET", "/", map[string]string{"host": "example.org"})), "\r\n\r\ndefault")
+	assert.Contains(t, testutil.Serve(m.ServeRequest, testutil.NewRequest("GET", "/", map[string]string{"host": "127.0.0.1:42069"})), "\r\n\r\ndefault")
+}
+
+func TestMissingHostRejected(t *testing.T) {
+	srv, err := Serve(0, textHandler("ok"))
+	require.NoError(t, err)
+	defer srv.Close()
+
+	// Test: HTTP/1.1 without Host is a 400, not a 500
+	conn := dial(t, srv)
+	defer conn.Close()
+	conn.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	buf := &bytes.Buffer{}
+	buf.ReadFrom(conn)
+	assert.Contains(t, buf.String(), "HTTP/1.1 400 Bad Request\r\n")
+	assert.Contains(t, buf.String(), "missing host header")
+}
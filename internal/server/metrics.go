@@ -0,0 +1,106 @@
+package server
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"boot.httpserver/internal/metrics"
+	"boot.httpserver/internal/request"
+	"boot.httpserver/internal/response"
+)
+
+// Metrics are the collectors a server reports to. Servers given the same
+// Metrics add up into the same series
+type Metrics struct {
+	registry *metrics.Registry
+
+	activeConns   *metrics.Gauge
+	rejectedConns *metrics.Counter
+	requests      *metrics.CounterVec
+	duration      *metrics.HistogramVec
+	bytesIn       *metrics.Counter
+	bytesOut      *metrics.Counter
+	parseErrors   *metrics.Counter
+}
+
+// NewMetrics registers the server metrics on r. Doing so twice on one
+// registry panics, so build one Metrics and share it
+func NewMetrics(r *metrics.Registry) *Metrics {
+	return &Metrics{
+		registry:      r,
+		activeConns:   r.NewGauge("httpserver_active_connections", "Connections currently being handled."),
+		rejectedConns: r.NewCounter("httpserver_rejected_connections_total", "Connections turned away by the per-IP cap."),
+		requests:      r.NewCounterVec("httpserver_requests_total", "Requests handled, by method and status.", "method", "status"),
+		duration:      r.NewHistogramVec("httpserver_request_duration_seconds", "Time from a parsed request to the flushed response.", metrics.DefaultBuckets, "method"),
+		bytesIn:       r.NewCounter("httpserver_received_bytes_total", "Bytes read from clients."),
+		bytesOut:      r.NewCounter("httpserver_sent_bytes_total", "Bytes written to clients."),
+		parseErrors:   r.NewCounter("httpserver_parse_errors_total", "Connections whose request could not be parsed."),
+	}
+}
+
+// Metrics returns the registry the server reports to; applications may
+// register their own metrics on it
+func (s *Server) Metrics() *metrics.Registry {
+	return s.metrics.registry
+}
+
+func (m *Metrics) observe(method string, status string, start time.Time) {
+	method = methodLabel(method)
+	m.requests.With(method, status).Inc()
+	m.duration.With(method).Observe(time.Since(start).Seconds())
+}
+
+// methods are client supplied, so unknown ones share a label to keep the
+// number of series bounded
+func methodLabel(method string) string {
+	switch method {
+	case "GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "CONNECT", "TRACE":
+		return method
+	}
+	return "OTHER"
+}
+
+func statusLabel(w *response.Writer) string {
+	if w.Hijacked() {
+		return "hijacked"
+	}
+	return strconv.Itoa(int(w.Status()))
+}
+
+// MetricsHandler renders registry in the Prometheus text format. The
+// metrics say a lot about the traffic, so mount it somewhere private
+// or behind auth
+func MetricsHandler(registry *metrics.Registry) Handler {
+	return func(w *response.Writer, req *request.Request) {
+		method := req.RequestLine.Method
+		if method != "GET" && method != "HEAD" {
+			w.Header().Set("Allow", "GET, HEAD")
+			WriteError(w, req, response.METHODNOTALLOWED, "method not allowed")
+			return
+		}
+		w.Header().Set("Content-Type", metrics.ContentType)
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(response.OK)
+		registry.WriteTo(w)
+	}
+}
+
+// countingConn tallies the bytes that cross the connection
+type countingConn struct {
+	net.Conn
+	in  *metrics.Counter
+	out *metrics.Counter
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.in.Add(float64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.out.Add(float64(n))
+	return n, err
+}
@@ -0,0 +1,11 @@
+package server
+
+type Middleware func(Handler) Handler
+
+// Chain wraps handler so that the first middleware is the outermost
+func Chain(handler Handler, middlewares ...Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
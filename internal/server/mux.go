@@ -0,0 +1,131 @@
+package server
+
+import (
+	"slices"
+	"strings"
+
+	"boot.httpserver/internal/request"
+	"boot.httpserver/internal/response"
+)
+
+type route struct {
+	method  string
+	pattern string
+	handler Handler
+}
+
+// Mux dispatches on method and path. A pattern ending in "/" matches
+// every path under it, anything else must match exactly; the longest
+// matching pattern wins. HEAD falls back to the GET handler, with the
+// Writer dropping the body, and OPTIONS is answered with the allowed
+// methods unless a handler was registered for it
+type Mux struct {
+	routes []route
+}
+
+func NewMux() *Mux {
+	return &Mux{}
+}
+
+// Handle registers handler for method and pattern; an empty method
+// accepts any method
+func (m *Mux) Handle(method, pattern string, handler Handler) {
+	m.routes = append(m.routes, route{method: method, pattern: pattern, handler: handler})
+}
+
+func (m *Mux) ServeRequest(w *response.Writer, req *request.Request) {
+	target := req.RequestLine.RequestTarget
+	method := req.RequestLine.Method
+
+	if target == "*" {
+		if method == "OPTIONS" {
+			writeOptions(w, m.methods(m.routes))
+			return
+		}
+		WriteError(w, req, response.BADREQUEST, "bad request")
+		return
+	}
+
+	routes := m.match(req.Path())
+	if len(routes) == 0 {
+		WriteError(w, req, response.NOTFOUND, "not found")
+		return
+	}
+
+	if h := findHandler(routes, method); h != nil {
+		h(w, req)
+		return
+	}
+	if method == "HEAD" {
+		if h := findHandler(routes, "GET"); h != nil {
+			h(w, req)
+			return
+		}
+	}
+
+	allowed := m.methods(routes)
+	if method == "OPTIONS" {
+		writeOptions(w, allowed)
+		return
+	}
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	WriteError(w, req, response.METHODNOTALLOWED, "method not allowed")
+}
+
+// match returns the routes registered under the longest pattern that
+// matches path
+func (m *Mux) match(path string) []route {
+	var matched []route
+	best := -1
+	for _, r := range m.routes {
+		if !patternMatches(r.pattern, path) {
+			continue
+		}
+		switch {
+		case len(r.pattern) > best:
+			best = len(r.pattern)
+			matched = []route{r}
+		case len(r.pattern) == best:
+			matched = append(matched, r)
+		}
+	}
+	return matched
+}
+
+func patternMatches(pattern, path string) bool {
+	if strings.HasSuffix(pattern, "/") {
+		return strings.HasPrefix(path, pattern) || path+"/" == pattern
+	}
+	return path == pattern
+}
+
+func findHandler(routes []route, method string) Handler {
+	for _, r := range routes {
+		if r.method == method || r.method == "" {
+			return r.handler
+		}
+	}
+	return nil
+}
+
+func (m *Mux) methods(routes []route) []string {
+	methods := []string{"OPTIONS"}
+	for _, r := range routes {
+		if r.method == "" {
+			return []string{"CONNECT", "DELETE", "GET", "HEAD", "OPTIONS", "PATCH", "POST", "PUT", "TRACE"}
+		}
+		methods = append(methods, r.method)
+		if r.method == "GET" {
+			methods = append(methods, "HEAD")
+		}
+	}
+	slices.Sort(methods)
+	return slices.Compact(methods)
+}
+
+// writeOptions answers OPTIONS the way the 405 path does, through the
+// writer's headers, only with 204 and nothing to report
+func writeOptions(w *response.Writer, allowed []string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	w.WriteHeader(response.NOCONTENT)
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"testing"
+
+	"boot.httpserver/internal/request"
+	"boot.httpserver/internal/response"
+	"boot.httpserver/internal/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func textHandler(body string) Handler {
+	return func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.OK)
+		w.WriteHeaders(response.DefaultHeaders())
+		w.WriteBody([]byte(body))
+	}
+}
+
+func newTestMux() *Mux {
+	m := NewMux()
+	m.Handle("GET", "/", textHandler("root"))
+	m.Handle("GET", "/api/", textHandler("api"))
+	m.Handle("POST", "/api/", textHandler("api post"))
+	m.Handle("GET", "/api/users", textHandler("users"))
+	m.Handle("", "/any", textHandler("any"))
+	return m
+}
+
+func TestMuxRouting(t *testing.T) {
+	m := newTestMux()
+
+	assert.Contains(t, testutil.Serve(m.ServeRequest, testutil.NewRequest("GET", "/", nil)), "\r\n\r\nroot")
+	assert.Contains(t, testutil.Serve(m.ServeRequest, testutil.NewRequest("GET", "/elsewhere", nil)), "\r\n\r\nroot")
+	assert.Contains(t, testutil.Serve(m.ServeRequest, testutil.NewRequest("GET", "/api", nil)), "\r\n\r\napi")
+	assert.Contains(t, testutil.Serve(m.ServeRequest, testutil.NewRequest("GET", "/api/orders?page=2", nil)), "\r\n\r\napi")
+	assert.Contains(t, testutil.Serve(m.ServeRequest, testutil.NewRequest("POST", "/api/orders", nil)), "\r\n\r\napi post")
+	assert.Contains(t, testutil.Serve(m.ServeRequest, testutil.NewRequest("GET", "/api/users", nil)), "\r\n\r\nusers")
+	assert.Contains(t, testutil.Serve(m.ServeRequest, testutil.NewRequest("DELETE", "/any", nil)), "\r\n\r\nany")
+
+	// Test: no route at all
+	empty := NewMux()
+	assert.Contains(t, testutil.Serve(empty.ServeRequest, testutil.NewRequest("GET", "/", nil)), "HTTP/1.1 404 Not Found\r\n")
+}
+
+func TestMuxMethodNotAllowed(t *testing.T) {
+	out := testutil.Serve(newTestMux().ServeRequest, testutil.NewRequest("DELETE", "/api/users", nil))
+	assert.Contains(t, out, "HTTP/1.1 405 Method Not Allowed\r\n")
+	assert.Contains(t, out, "Allow: GET, HEAD, OPTIONS\r\n")
+}
+
+func TestMuxHead(t *testing.T) {
+	out := testutil.Serve(newTestMux().ServeRequest, testutil.NewRequest("HEAD", "/api/users", nil))
+	assert.Contains(t, out, "HTTP/1.1 200 OK\r\n")
+	assert.Contains(t, out, "Content-Length: 5\r\n")
+	assert.NotContains(t, out, "users")
+}
+
+func TestMuxOptions(t *testing.T) {
+	m := newTestMux()
+
+	out := testutil.Serve(m.ServeRequest, testutil.NewRequest("OPTIONS", "/api/orders", nil))
+	assert.Contains(t, out, "HTTP/1.1 204 No Content\r\n")
+	assert.Contains(t, out, "Allow: GET, HEAD, OPTIONS, POST\r\n")
+
+	out = testutil.Serve(m.ServeRequest, testutil.NewRequest("OPTIONS", "*", nil))
+	assert.Contains(t, out, "Allow: CONNECT, DELETE, GET, HEAD, OPTIONS, PATCH, POST, PUT, TRACE\r\n")
+
+	// Test: asterisk form is only valid for OPTIONS
+	out = testutil.Serve(m.ServeRequest, testutil.NewRequest("GET", "*", nil))
+	assert.Contains(t, out, "HTTP/1.1 400 Bad Request\r\n")
+
+	// Test: a registered OPTIONS handler wins
+	m.Handle("OPTIONS", "/custom", textHandler("custom"))
+	assert.Contains(t, testutil.Serve(m.ServeRequest, testutil.NewRequest("OPTIONS", "/custom", nil)), "\r\n\r\ncustom")
+}
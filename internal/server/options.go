@@ -0,0 +1,73 @@
+package server
+
+import (
+	"crypto/tls"
+	"time"
+)
+
+type Option func(*Server)
+
+// WithMaxConns caps the connections handled at once. When saturated the
+// server stops accepting until one finishes, so new clients wait in the
+// listen backlog instead of piling up goroutines
+func WithMaxConns(n int) Option {
+	return func(s *Server) {
+		s.maxConns = n
+	}
+}
+
+// WithMaxConnsPerIP caps the connections one client address may hold.
+// Connections over the cap are answered with 503 and closed
+func WithMaxConnsPerIP(n int) Option {
+	return func(s *Server) {
+		s.maxConnsPerIP = n
+	}
+}
+
+// WithRetryAfter sets the Retry-After sent with connections turned away,
+// one second by default
+func WithRetryAfter(d time.Duration) Option {
+	return func(s *Server) {
+		s.retryAfter = d
+	}
+}
+
+// WithReadTimeout bounds how long a connection may take to send its
+// request, ten seconds by default. Connections that run out are closed
+// without an answer; 0 waits forever
+func WithReadTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.readTimeout = d
+	}
+}
+
+// WithMaxBodyBytes refuses requests declaring a body over n bytes with
+// 413 before reading it, 10 MiB by default; 0 means no limit
+func WithMaxBodyBytes(n int64) Option {
+	return func(s *Server) {
+		s.maxBodyBytes = n
+	}
+}
+
+// WithAcceptErrorHandler is called with every error from Accept other
+// than the listener closing. The server keeps accepting, backing off
+// between attempts. By default errors are logged
+func WithAcceptErrorHandler(fn func(err error)) Option {
+	return func(s *Server) {
+		s.onAcceptError = fn
+	}
+}
+
+// WithMetrics reports to m instead of a registry of the server's own
+func WithMetrics(m *Metrics) Option {
+	return func(s *Server) {
+		s.metrics = m
+	}
+}
+
+// WithTLSConfig serves HTTPS; config needs at least one certificate
+func WithTLSConfig(config *tls.Config) Option {
+	return func(s *Server) {
+		s.tlsConfig = config
+	}
+}
@@ -1,13 +1,19 @@
 package server
 
 import (
-	"bytes"
+	"bufio"
+	"crypto/tls"
+	"errors"
 	"io"
 	"log"
+	"math"
 	"net"
 	"strconv"
-	"sync/atomic"
+	"sync"
+	"time"
 
+	"boot.httpserver/internal/headers"
+	"boot.httpserver/internal/metrics"
 	"boot.httpserver/internal/request"
 	"boot.httpserver/internal/response"
 )
@@ -17,79 +23,341 @@ type HandlerError struct {
 	Message    string
 }
 
-func (e *HandlerError) writeError(w io.Writer) {
-	response.WriteStatus(w, response.StatusCode(e.StatusCode))
-	messageBytes := []byte(e.Message)
-	headers := response.GetDefaultHeaders(len(messageBytes))
-	response.WriteHeaders(w, headers)
-	w.Write(messageBytes)
+func (e *HandlerError) Error() string {
+	return e.Message
 }
 
+// Problem describes the error as RFC 9457 problem details
+func (e *HandlerError) Problem() response.Problem {
+	return response.Problem{
+		Status: response.StatusCode(e.StatusCode),
+		Detail: e.Message,
+	}
+}
+
+// Write answers req with the error, as application/problem+json when the
+// client prefers JSON and as plain text otherwise. req may be nil when the
+// request couldn't be parsed
+func (e *HandlerError) Write(w *response.Writer, req *request.Request) error {
+	if req != nil && prefersJSON(req) {
+		return response.WriteProblem(w, e.Problem())
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	if err := w.WriteHeader(response.StatusCode(e.StatusCode)); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, e.Message)
+	return err
+}
+
+// WriteError answers req with a HandlerError, so failures look the same
+// whichever package reports them
+func WriteError(w *response.Writer, req *request.Request, statusCode response.StatusCode, message string) error {
+	herr := &HandlerError{StatusCode: int(statusCode), Message: message}
+	return herr.Write(w, req)
+}
+
+// prefersJSON reports whether the first media range the client accepts,
+// by preference, is a JSON one. */* counts as no preference
+func prefersJSON(req *request.Request) bool {
+	accept, ok := req.Headers.Get("Accept")
+	if !ok {
+		return false
+	}
+	for _, qv := range headers.ParseQualityValues(accept) {
+		if qv.Q == 0 {
+			break
+		}
+		switch qv.Value {
+		case "application/json", "application/problem+json", "application/*":
+			return true
+		case "*/*":
+			continue
+		}
+		return false
+	}
+	return false
+}
+
+// how long a rejected connection gets to send its request
+const rejectTimeout = time.Second
+
+// how long any other connection gets, unless WithReadTimeout says otherwise
+const defaultReadTimeout = 10 * time.Second
+
+const defaultMaxBodyBytes = 10 << 20
+
 type Handler func(w *response.Writer, req *request.Request)
 
 type Server struct {
 	handler   Handler
-	listening atomic.Bool
 	listener  net.Listener
+	done      chan struct{}
+	closeOnce sync.Once
+
+	maxConns      int
+	maxConnsPerIP int
+	retryAfter    time.Duration
+	readTimeout   time.Duration
+	maxBodyBytes  int64
+	onAcceptError func(err error)
+	tlsConfig     *tls.Config
+
+	metrics *Metrics
+
+	// a token per connection being handled, when maxConns is set
+	slots   chan struct{}
+	ipMu    sync.Mutex
+	ipConns map[string]int
 }
 
-func Serve(port int, handler Handler) (*Server, error) {
-	server := &Server{}
-	listener, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+func Serve(port int, handler Handler, opts ...Option) (*Server, error) {
+	return ServeAddr(":"+strconv.Itoa(port), handler, opts...)
+}
+
+// ServeAddr listens on a host:port address such as "127.0.0.1:8080"
+func ServeAddr(addr string, handler Handler, opts ...Option) (*Server, error) {
+	listener, err := net.Listen("tcp", addr)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+	server := newServer(listener, handler, opts...)
+	if server.tlsConfig != nil {
+		server.listener = tls.NewListener(listener, server.tlsConfig)
 	}
-	server.listener = listener
-	server.handler = handler
 	go server.listen()
-	server.listening.Store(true)
 	return server, nil
 }
 
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+func newServer(listener net.Listener, handler Handler, opts ...Option) *Server {
+	server := &Server{
+		handler:      handler,
+		listener:     listener,
+		done:         make(chan struct{}),
+		retryAfter:   time.Second,
+		readTimeout:  defaultReadTimeout,
+		maxBodyBytes: defaultMaxBodyBytes,
+		ipConns:      map[string]int{},
+		onAcceptError: func(err error) {
+			log.Printf("Error accepting connection: %v\n", err)
+		},
+	}
+	for _, opt := range opts {
+		opt(server)
+	}
+	if server.metrics == nil {
+		server.metrics = NewMetrics(metrics.NewRegistry())
+	}
+	if server.maxConns > 0 {
+		server.slots = make(chan struct{}, server.maxConns)
+	}
+	return server
+}
+
+const (
+	minAcceptBackoff = 5 * time.Millisecond
+	maxAcceptBackoff = time.Second
+)
+
 func (s *Server) listen() {
+	var backoff time.Duration
 	for {
+		if s.slots != nil {
+			select {
+			case s.slots <- struct{}{}:
+			case <-s.done:
+				return
+			}
+		}
 		conn, err := s.listener.Accept()
 		if err != nil {
-			if !s.listening.Load() {
+			s.release()
+			if s.closed() || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			s.onAcceptError(err)
+			// errors like EMFILE clear up once connections finish, so
+			// retrying straight away would only spin
+			if backoff == 0 {
+				backoff = minAcceptBackoff
+			} else {
+				backoff = min(2*backoff, maxAcceptBackoff)
+			}
+			select {
+			case <-time.After(backoff):
+			case <-s.done:
 				return
 			}
-			log.Printf("Error accepting connection: %v\n", err)
 			continue
 		}
-		go s.handle(conn)
+		backoff = 0
+
+		ip := clientIP(conn)
+		if !s.acquireIP(ip) {
+			s.metrics.rejectedConns.Inc()
+			go func() {
+				defer s.release()
+				s.reject(conn)
+			}()
+			continue
+		}
+		go func() {
+			defer s.release()
+			defer s.releaseIP(ip)
+			s.metrics.activeConns.Inc()
+			defer s.metrics.activeConns.Dec()
+			s.handle(conn)
+		}()
 	}
 }
 
-func (s *Server) handle(conn net.Conn) {
+func (s *Server) closed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Server) release() {
+	if s.slots != nil {
+		<-s.slots
+	}
+}
+
+func clientIP(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
+
+func (s *Server) acquireIP(ip string) bool {
+	if s.maxConnsPerIP <= 0 {
+		return true
+	}
+	s.ipMu.Lock()
+	defer s.ipMu.Unlock()
+	if s.ipConns[ip] >= s.maxConnsPerIP {
+		return false
+	}
+	s.ipConns[ip]++
+	return true
+}
+
+func (s *Server) releaseIP(ip string) {
+	if s.maxConnsPerIP <= 0 {
+		return
+	}
+	s.ipMu.Lock()
+	defer s.ipMu.Unlock()
+	s.ipConns[ip]--
+	if s.ipConns[ip] <= 0 {
+		delete(s.ipConns, ip)
+	}
+}
+
+// reject turns a connection away with 503. The request is read first,
+// briefly, since closing on unread data can make the client lose the answer
+func (s *Server) reject(conn net.Conn) {
 	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(rejectTimeout))
+	req, _, err := request.ReadRequest(conn, s.maxBodyBytes)
+	if err != nil {
+		req = nil
+	}
+
+	writer := &response.Writer{Wrt: conn}
+	if req != nil {
+		writer.Method = req.RequestLine.Method
+	}
+	writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(s.retryAfter.Seconds()))))
+	herr := &HandlerError{StatusCode: response.SERVICEUNAVAILABLE, Message: "too many connections"}
+	herr.Write(writer, req)
+	writer.Finish()
+}
+
+func (s *Server) handle(conn net.Conn) {
+	conn = &countingConn{Conn: conn, in: s.metrics.bytesIn, out: s.metrics.bytesOut}
+	hijacked := false
+	defer func() {
+		if !hijacked {
+			conn.Close()
+		}
+	}()
 	log.Printf("Got connection from %s\n", conn.RemoteAddr())
 
-	rq, err := request.RequestFromReader(conn)
+	// a client that never finishes its request would otherwise hold its
+	// connection slot for good
+	if s.readTimeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(s.readTimeout))
+	}
+	rq, buffered, err := request.ReadRequest(conn, s.maxBodyBytes)
+	conn.SetReadDeadline(time.Time{})
 
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		s.metrics.parseErrors.Inc()
+		log.Printf("Timed out reading request from %s\n", conn.RemoteAddr())
+		return
+	}
 	if err != nil {
 		errorHandler := &HandlerError{
 			StatusCode: 500,
 			Message:    err.Error(),
 		}
-		errorHandler.writeError(conn)
+		switch {
+		case errors.Is(err, request.ErrMissingHost), errors.Is(err, request.ErrInvalidHost):
+			errorHandler.StatusCode = response.BADREQUEST
+		case errors.Is(err, request.ErrBodyTooLarge):
+			errorHandler.StatusCode = response.CONTENTTOOLARGE
+		}
+		writer := &response.Writer{Wrt: conn}
+		errorHandler.Write(writer, nil)
+		writer.Finish()
+		s.metrics.parseErrors.Inc()
 		log.Printf("Error creating error: %v\n", err)
 		return
 	}
+	rq.RemoteAddr = conn.RemoteAddr().String()
+	start := time.Now()
 
-	buf := bytes.NewBuffer([]byte{})
+	buf := bufio.NewWriter(conn)
 	writer := &response.Writer{}
 	writer.Wrt = buf
+	writer.Conn = conn
+	writer.Buffered = buffered
+	writer.Method = rq.RequestLine.Method
 
 	s.handler(writer, rq)
 
-	b := buf.Bytes()
-	conn.Write(b)
+	if writer.Hijacked() {
+		hijacked = true
+		s.metrics.observe(rq.RequestLine.Method, statusLabel(writer), start)
+		return
+	}
+
+	if err := writer.Finish(); err != nil {
+		log.Printf("Error finishing response: %v\n", err)
+	}
+
+	if err := buf.Flush(); err != nil {
+		log.Printf("Error writing response: %v\n", err)
+	}
+	s.metrics.observe(rq.RequestLine.Method, statusLabel(writer), start)
 }
 
 func (s *Server) Close() error {
-	s.listening.Store(false)
-	if s.listener != nil {
-		return s.listener.Close()
-	}
-	return nil
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.done)
+		err = s.listener.Close()
+	})
+	return err
 }
@@ -0,0 +1,373 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"boot.httpserver/internal/metrics"
+	"boot.httpserver/internal/request"
+	"boot.httpserver/internal/response"
+	"boot.httpserver/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func dial(t *testing.T, s *Server) net.Conn {
+	conn, err := net.Dial("tcp", s.listener.Addr().String())
+	require.NoError(t, err)
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func TestHijack(t *testing.T) {
+	srv, err := Serve(0, func(w *response.Writer, req *request.Request) {
+		conn, buffered, err := w.Hijack()
+		if err != nil {
+			return
+		}
+		assert.ErrorIs(t, w.WriteStatusLine(response.OK), response.ErrHijacked)
+
+		// keep talking after the handler returned
+		go func() {
+			defer conn.Close()
+			payload := make([]byte, 4)
+			if _, err := io.ReadFull(io.MultiReader(bytes.NewReader(buffered), conn), payload); err != nil {
+				return
+			}
+			time.Sleep(50 * time.Millisecond)
+			conn.Write([]byte("raw:" + string(payload)))
+		}()
+	})
+	require.NoError(t, err)
+	defer srv.Close()
+
+	conn := dial(t, srv)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET /tunnel HTTP/1.1\r\nHost: localhost\r\n\r\nping"))
+	require.NoError(t, err)
+
+	got, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Equal(t, "raw:ping", string(got))
+}
+
+func TestResponseWithoutHijack(t *testing.T) {
+	srv, err := Serve(0, func(w *response.Writer, req *request.Request) {
+		body := []byte("hello")
+		w.WriteStatusLine(response.OK)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+	})
+	require.NoError(t, err)
+	defer srv.Close()
+
+	conn := dial(t, srv)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+
+	status, err := bufio.NewReader(conn).ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", status)
+}
+
+func TestHandlerErrorNegotiation(t *testing.T) {
+	herr := &HandlerError{StatusCode: response.NOTFOUND, Message: "no such user"}
+	write := func(accept string) string {
+		h := map[string]string{}
+		if accept != "" {
+			h["accept"] = accept
+		}
+		return testutil.Serve(func(w *response.Writer, req *request.Request) {
+			require.NoError(t, herr.Write(w, req))
+		}, testutil.NewRequest("GET", "/", h))
+	}
+
+	// Test: plain text without a JSON preference
+	for _, accept := range []string{"", "*/*", "text/html, application/json;q=0.9"} {
+		out := write(accept)
+		assert.Contains(t, out, "HTTP/1.1 404 Not Found\r\n")
+		assert.Contains(t, out, "Content-Type: text/plain\r\n")
+		assert.True(t, strings.HasSuffix(out, "\r\n\r\nno such user"), accept)
+	}
+
+	// Test: problem details for JSON clients
+	for _, accept := range []string{"application/json", "*/*;q=0.1, application/problem+json"} {
+		out := write(accept)
+		assert.Contains(t, out, "HTTP/1.1 404 Not Found\r\n")
+		assert.Contains(t, out, "Content-Type: application/problem+json\r\n")
+		assert.Contains(t, out, `{"detail":"no such user","status":404,"title":"Not Found"}`, accept)
+	}
+}
+
+func blockingServer(t *testing.T, release chan struct{}, opts ...Option) *Server {
+	srv, err := Serve(0, func(w *response.Writer, req *request.Request) {
+		<-release
+		w.WriteHeader(response.OK)
+		io.WriteString(w, "done")
+	}, opts...)
+	require.NoError(t, err)
+	return srv
+}
+
+func sendRequest(t *testing.T, conn net.Conn) {
+	_, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+}
+
+func TestMaxConns(t *testing.T) {
+	release := make(chan struct{})
+	srv := blockingServer(t, release, WithMaxConns(1))
+	defer srv.Close()
+
+	first := dial(t, srv)
+	defer first.Close()
+	sendRequest(t, first)
+	second := dial(t, srv)
+	defer second.Close()
+	sendRequest(t, second)
+
+	// Test: the second connection waits while the first is handled
+	second.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	_, err := second.Read(make([]byte, 1))
+	var netErr net.Error
+	require.ErrorAs(t, err, &netErr)
+	assert.True(t, netErr.Timeout())
+
+	close(release)
+	second.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for _, conn := range []net.Conn{first, second} {
+		status, err := bufio.NewReader(conn).ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, "HTTP/1.1 200 OK\r\n", status)
+	}
+}
+
+func TestMaxConnsPerIP(t *testing.T) {
+	release := make(chan struct{})
+	srv := blockingServer(t, release, WithMaxConnsPerIP(1), WithRetryAfter(3*time.Second))
+	defer srv.Close()
+
+	first := dial(t, srv)
+	defer first.Close()
+	sendRequest(t, first)
+	time.Sleep(50 * time.Millisecond)
+
+	// Test: a second connection from the same address is turned away
+	second := dial(t, srv)
+	defer second.Close()
+	sendRequest(t, second)
+	got, err := io.ReadAll(second)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(got), "HTTP/1.1 503 Service Unavailable\r\n"))
+	assert.Contains(t, string(got), "Retry-After: 3\r\n")
+
+	close(release)
+	got, err = io.ReadAll(first)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(got), "HTTP/1.1 200 OK\r\n"))
+
+	// Test: the slot is freed once the connection is done
+	time.Sleep(50 * time.Millisecond)
+	third := dial(t, srv)
+	defer third.Close()
+	sendRequest(t, third)
+	got, err = io.ReadAll(third)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(got), "HTTP/1.1 200 OK\r\n"))
+}
+
+func TestReadTimeoutFreesSlot(t *testing.T) {
+	srv, err := Serve(0, func(w *response.Writer, req *request.Request) {
+		w.WriteHeader(response.OK)
+	}, WithMaxConns(1), WithReadTimeout(100*time.Millisecond))
+	require.NoError(t, err)
+	defer srv.Close()
+
+	// Test: a client that never finishes its headers is dropped
+	stalled := dial(t, srv)
+	defer stalled.Close()
+	_, err = stalled.Write([]byte("GET / HTTP/1.1\r\nHost: local"))
+	require.NoError(t, err)
+	got, err := io.ReadAll(stalled)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+
+	// Test: and the next client gets its slot
+	next := dial(t, srv)
+	defer next.Close()
+	sendRequest(t, next)
+	status, err := bufio.NewReader(next).ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", status)
+}
+
+func TestMaxBodyBytes(t *testing.T) {
+	srv, err := Serve(0, func(w *response.Writer, req *request.Request) {
+		w.WriteHeader(response.OK)
+	}, WithMaxBodyBytes(10))
+	require.NoError(t, err)
+	defer srv.Close()
+
+	// Test: answered from the headers alone, the body is never waited for
+	conn := dial(t, srv)
+	defer conn.Close()
+	_, err = conn.Write([]byte("POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 1000000\r\n\r\n"))
+	require.NoError(t, err)
+	status, err := bufio.NewReader(conn).ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 413 Content Too Large\r\n", status)
+}
+
+// failingListener fails the first accepts, then blocks until closed
+type failingListener struct {
+	net.Listener
+	failures int
+	calls    chan time.Time
+	closed   chan struct{}
+}
+
+func (l *failingListener) Accept() (net.Conn, error) {
+	l.calls <- time.Now()
+	if l.failures > 0 {
+		l.failures--
+		return nil, errors.New("accept tcp: too many open files")
+	}
+	<-l.closed
+	return nil, net.ErrClosed
+}
+
+func (l *failingListener) Close() error {
+	close(l.closed)
+	return nil
+}
+
+func TestAcceptBackoff(t *testing.T) {
+	l := &failingListener{failures: 5, calls: make(chan time.Time, 10), closed: make(chan struct{})}
+	var acceptErrors []error
+	srv := newServer(l, nil, WithAcceptErrorHandler(func(err error) {
+		acceptErrors = append(acceptErrors, err)
+	}))
+
+	stopped := make(chan struct{})
+	go func() {
+		srv.listen()
+		close(stopped)
+	}()
+
+	var calls []time.Time
+	for range 6 {
+		calls = append(calls, <-l.calls)
+	}
+	// 5ms, 10ms, 20ms, 40ms and 80ms between the attempts
+	assert.GreaterOrEqual(t, calls[5].Sub(calls[0]), 155*time.Millisecond)
+	assert.GreaterOrEqual(t, calls[5].Sub(calls[4]), 80*time.Millisecond)
+
+	// Test: closing ends the loop without reporting an error
+	require.NoError(t, srv.Close())
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("accept loop did not stop")
+	}
+	assert.Len(t, acceptErrors, 5)
+	assert.NoError(t, srv.Close())
+}
+
+func TestCloseImmediatelyAfterServe(t *testing.T) {
+	srv, err := Serve(0, func(w *response.Writer, req *request.Request) {})
+	require.NoError(t, err)
+	require.NoError(t, srv.Close())
+
+	_, err = net.DialTimeout("tcp", srv.listener.Addr().String(), 100*time.Millisecond)
+	assert.Error(t, err)
+}
+
+func TestMetrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+	mux := NewMux()
+	mux.Handle("GET", "/metrics", MetricsHandler(registry))
+	mux.Handle("GET", "/", func(w *response.Writer, req *request.Request) {
+		w.WriteHeader(response.NOTFOUND)
+	})
+	serverMetrics := NewMetrics(registry)
+	srv, err := Serve(0, mux.ServeRequest, WithMetrics(serverMetrics))
+	require.NoError(t, err)
+	defer srv.Close()
+	assert.Same(t, registry, srv.Metrics())
+
+	conn := dial(t, srv)
+	_, err = conn.Write([]byte("GET /missing HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	_, err = io.ReadAll(conn)
+	require.NoError(t, err)
+	conn.Close()
+
+	conn = dial(t, srv)
+	_, err = conn.Write([]byte("garbage\r\n\r\n"))
+	require.NoError(t, err)
+	io.ReadAll(conn)
+	conn.Close()
+
+	conn = dial(t, srv)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET /metrics HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	got, err := io.ReadAll(conn)
+	require.NoError(t, err)
+
+	out := string(got)
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, out, "Content-Type: text/plain; version=0.0.4; charset=utf-8\r\n")
+	assert.Contains(t, out, `httpserver_requests_total{method="GET",status="404"} 1`+"\n")
+	assert.Contains(t, out, `httpserver_request_duration_seconds_count{method="GET"} 1`+"\n")
+	assert.Contains(t, out, "httpserver_parse_errors_total 1\n")
+	// the scrape itself is in flight
+	assert.Contains(t, out, "httpserver_active_connections 1\n")
+	assert.NotContains(t, out, "httpserver_received_bytes_total 0\n")
+	assert.NotContains(t, out, "httpserver_sent_bytes_total 0\n")
+
+	// Test: a second server with the same metrics adds to the same series
+	other, err := Serve(0, mux.ServeRequest, WithMetrics(serverMetrics))
+	require.NoError(t, err)
+	defer other.Close()
+	conn = dial(t, other)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET /missing HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	io.ReadAll(conn)
+	buf := &bytes.Buffer{}
+	registry.WriteTo(buf)
+	assert.Contains(t, buf.String(), `httpserver_requests_total{method="GET",status="404"} 2`+"\n")
+}
+
+func TestServeTLS(t *testing.T) {
+	// borrow the test certificate of the standard library's test server
+	ts := httptest.NewUnstartedServer(nil)
+	ts.StartTLS()
+	certs := ts.TLS.Certificates
+	ts.Close()
+
+	srv, err := ServeAddr("127.0.0.1:0", func(w *response.Writer, req *request.Request) {
+		io.WriteString(w, "secure")
+	}, WithTLSConfig(&tls.Config{Certificates: certs}))
+	require.NoError(t, err)
+	defer srv.Close()
+
+	conn, err := tls.Dial("tcp", srv.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	require.NoError(t, err)
+	defer conn.Close()
+	sendRequest(t, conn)
+	got, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(got), "HTTP/1.1 200 OK\r\n"))
+	assert.True(t, strings.HasSuffix(string(got), "\r\n\r\nsecure"))
+}
@@ -0,0 +1,166 @@
+package sse
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"boot.httpserver/internal/request"
+	"boot.httpserver/internal/response"
+)
+
+var ErrStreamClosed = errors.New("sse: stream closed")
+
+type Event struct {
+	ID    string
+	Event string
+	Data  string
+	// reconnection delay the browser should use, sent when non-zero
+	Retry time.Duration
+}
+
+type Stream struct {
+	// value of the client's Last-Event-ID header, empty on a first connect
+	LastEventID string
+
+	w        *response.Writer
+	mu       sync.Mutex
+	closed   bool
+	stopBeat chan struct{}
+}
+
+func LastEventID(req *request.Request) string {
+	id, _ := req.Headers.Get("Last-Event-ID")
+	return id
+}
+
+// NewStream answers req with a text/event-stream response; events are
+// then pushed with Send until Close
+func NewStream(w *response.Writer, req *request.Request) (*Stream, error) {
+	h := response.DefaultHeaders()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Transfer-Encoding", "chunked")
+	// stop reverse proxies such as nginx from buffering the stream
+	h.Set("X-Accel-Buffering", "no")
+
+	if err := w.WriteStatusLine(response.OK); err != nil {
+		return nil, err
+	}
+	if err := w.WriteHeaders(h); err != nil {
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	return &Stream{
+		LastEventID: LastEventID(req),
+		w:           w,
+	}, nil
+}
+
+func (s *Stream) Send(e Event) error {
+	var b strings.Builder
+	if e.Event != "" {
+		writeField(&b, "event", oneLine(e.Event))
+	}
+	if e.ID != "" {
+		writeField(&b, "id", oneLine(e.ID))
+	}
+	if e.Retry > 0 {
+		writeField(&b, "retry", strconv.FormatInt(e.Retry.Milliseconds(), 10))
+	}
+	// every line of the payload needs its own data field
+	for _, line := range splitLines(e.Data) {
+		writeField(&b, "data", line)
+	}
+	b.WriteString("\n")
+	return s.write(b.String())
+}
+
+// Comment sends a line clients ignore, which keeps idle connections and
+// intermediaries from timing out
+func (s *Stream) Comment(text string) error {
+	var b strings.Builder
+	for _, line := range splitLines(text) {
+		b.WriteString(": " + line + "\n")
+	}
+	b.WriteString("\n")
+	return s.write(b.String())
+}
+
+// Heartbeat sends a comment every interval until the stream is closed or
+// a write fails
+func (s *Stream) Heartbeat(interval time.Duration) {
+	s.mu.Lock()
+	if s.stopBeat != nil || s.closed {
+		s.mu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	s.stopBeat = stop
+	s.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := s.Comment("heartbeat"); err != nil {
+					return
+				}
+			}
+		}
+	}()
+}
+
+func (s *Stream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if s.stopBeat != nil {
+		close(s.stopBeat)
+	}
+	if err := s.w.Finish(); err != nil {
+		return err
+	}
+	return s.w.Flush()
+}
+
+func (s *Stream) write(data string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrStreamClosed
+	}
+	if _, err := s.w.WriteChunkedBody([]byte(data)); err != nil {
+		return err
+	}
+	return s.w.Flush()
+}
+
+func writeField(b *strings.Builder, name, value string) {
+	b.WriteString(name)
+	b.WriteString(": ")
+	b.WriteString(value)
+	b.WriteString("\n")
+}
+
+// a line break inside a single-line field would start a new field
+func oneLine(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
+
+func splitLines(s string) []string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\r", "\n")
+	return strings.Split(s, "\n")
+}
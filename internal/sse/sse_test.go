@@ -0,0 +1,69 @@
+package sse
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"boot.httpserver/internal/response"
+	"boot.httpserver/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStream(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := &response.Writer{Wrt: buf}
+	s, err := NewStream(w, testutil.NewRequest("GET", "/events", map[string]string{"last-event-id": "41"}))
+	require.NoError(t, err)
+	assert.Equal(t, "41", s.LastEventID)
+
+	require.NoError(t, s.Send(Event{ID: "42", Event: "update", Data: "line one\nline two", Retry: 3 * time.Second}))
+	require.NoError(t, s.Send(Event{Data: "plain"}))
+	require.NoError(t, s.Comment("heartbeat"))
+	require.NoError(t, s.Close())
+	assert.ErrorIs(t, s.Send(Event{Data: "late"}), ErrStreamClosed)
+
+	res, err := http.ReadResponse(bufio.NewReader(buf), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+	assert.Equal(t, "no-cache", res.Header.Get("Cache-Control"))
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "event: update\nid: 42\nretry: 3000\ndata: line one\ndata: line two\n\n"+
+		"data: plain\n\n"+
+		": heartbeat\n\n", string(body))
+}
+
+func TestFieldsStayOnOneLine(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := &response.Writer{Wrt: buf}
+	s, err := NewStream(w, testutil.NewRequest("GET", "/events", nil))
+	require.NoError(t, err)
+	require.NoError(t, s.Send(Event{ID: "1\ndata: injected", Data: "ok"}))
+	assert.Contains(t, buf.String(), "id: 1data: injected\ndata: ok\n\n")
+}
+
+type flushRecorder struct {
+	bytes.Buffer
+	flushes int
+}
+
+func (f *flushRecorder) Flush() error {
+	f.flushes++
+	return nil
+}
+
+func TestFlushPerEvent(t *testing.T) {
+	rec := &flushRecorder{}
+	w := &response.Writer{Wrt: rec}
+	s, err := NewStream(w, testutil.NewRequest("GET", "/events", nil))
+	require.NoError(t, err)
+	before := rec.flushes
+	require.NoError(t, s.Send(Event{Data: "a"}))
+	require.NoError(t, s.Send(Event{Data: "b"}))
+	assert.Equal(t, before+2, rec.flushes)
+}
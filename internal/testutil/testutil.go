@@ -0,0 +1,57 @@
+// Package testutil builds requests and runs handlers for the tests of the
+// other packages
+package testutil
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"boot.httpserver/internal/headers"
+	"boot.httpserver/internal/request"
+	"boot.httpserver/internal/response"
+	"github.com/stretchr/testify/require"
+)
+
+// NewRequest builds an HTTP/1.1 request the way the parser hands it to
+// handlers. h is copied into the headers as is, so names should be
+// lowercase like parsed ones
+func NewRequest(method, target string, h map[string]string) *request.Request {
+	req := &request.Request{
+		RequestLine: request.RequestLine{Method: method, RequestTarget: target, HttpVersion: "1.1"},
+		Headers:     headers.NewHeaders(),
+	}
+	for k, v := range h {
+		req.Headers[k] = v
+	}
+	return req
+}
+
+// NewRemoteRequest is a GET of / from remoteAddr, for code that looks at
+// the client rather than the target
+func NewRemoteRequest(remoteAddr string, h map[string]string) *request.Request {
+	req := NewRequest("GET", "/", h)
+	req.RemoteAddr = remoteAddr
+	return req
+}
+
+// Serve runs handler on req against a buffered writer and returns all it
+// wrote, finished the way the server finishes responses
+func Serve(handler func(*response.Writer, *request.Request), req *request.Request) string {
+	buf := &bytes.Buffer{}
+	w := &response.Writer{Wrt: buf, Method: req.RequestLine.Method}
+	handler(w, req)
+	w.Finish()
+	return buf.String()
+}
+
+// Do is Serve with the output parsed, for tests that look at headers
+func Do(t testing.TB, handler func(*response.Writer, *request.Request), req *request.Request) *http.Response {
+	t.Helper()
+	out := Serve(handler, req)
+	res, err := http.ReadResponse(bufio.NewReader(strings.NewReader(out)), &http.Request{Method: req.RequestLine.Method})
+	require.NoError(t, err)
+	return res
+}
@@ -0,0 +1,289 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+	"sync"
+	"time"
+
+	"boot.httpserver/internal/headers"
+)
+
+type TraceID [16]byte
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+type SpanID [8]byte
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+const FlagSampled byte = 0x01
+
+// SpanContext is the part of a span that crosses process boundaries in
+// the W3C traceparent and tracestate headers
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Flags      byte
+	TraceState string
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+func (sc SpanContext) Sampled() bool {
+	return sc.Flags&FlagSampled != 0
+}
+
+// Traceparent formats sc as a version 00 traceparent value
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, sc.Flags)
+}
+
+var ErrInvalidTraceparent = errors.New("invalid traceparent")
+
+// ParseTraceparent parses a W3C traceparent such as
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01". Versions
+// after 00 may append fields, which are ignored
+func ParseTraceparent(value string) (SpanContext, error) {
+	value = strings.TrimSpace(value)
+	parts := strings.Split(value, "-")
+	if len(parts) < 4 {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+	version, traceID, spanID, flags := parts[0], parts[1], parts[2], parts[3]
+	if !isLowerHex(version, 2) || version == "ff" {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+	if version == "00" && len(parts) != 4 {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+	if !isLowerHex(traceID, 32) || !isLowerHex(spanID, 16) || !isLowerHex(flags, 2) {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+
+	var sc SpanContext
+	hex.Decode(sc.TraceID[:], []byte(traceID))
+	hex.Decode(sc.SpanID[:], []byte(spanID))
+	var f [1]byte
+	hex.Decode(f[:], []byte(flags))
+	sc.Flags = f[0]
+	if !sc.IsValid() {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+	return sc, nil
+}
+
+func isLowerHex(s string, length int) bool {
+	if len(s) != length {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// Extract reads the caller's span context from request headers. A
+// tracestate is only kept alongside a valid traceparent
+func Extract(h headers.Headers) (SpanContext, bool) {
+	value, ok := h.Get("traceparent")
+	if !ok {
+		return SpanContext{}, false
+	}
+	sc, err := ParseTraceparent(value)
+	if err != nil {
+		return SpanContext{}, false
+	}
+	if state, ok := h.Get("tracestate"); ok {
+		sc.TraceState = strings.TrimSpace(state)
+	}
+	return sc, true
+}
+
+// Carrier is anything headers can be set on, such as headers.Headers or
+// the http.Header of an outgoing request
+type Carrier interface {
+	Set(key, value string)
+}
+
+// Inject writes the span context of the span in ctx to c
+func Inject(ctx context.Context, c Carrier) {
+	span := SpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+	sc := span.SpanContext()
+	c.Set("traceparent", sc.Traceparent())
+	if sc.TraceState != "" {
+		c.Set("tracestate", sc.TraceState)
+	}
+}
+
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = iota
+	SpanKindServer
+	SpanKindClient
+)
+
+type Span struct {
+	Name   string
+	Kind   SpanKind
+	Parent SpanID
+	// whether Parent belongs to another process
+	RemoteParent bool
+	StartTime    time.Time
+	EndTime      time.Time
+	Err          error
+
+	tracer   *Tracer
+	context  SpanContext
+	mu       sync.Mutex
+	attrs    map[string]string
+	finished bool
+}
+
+func (s *Span) SpanContext() SpanContext {
+	return s.context
+}
+
+func (s *Span) SetAttribute(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.attrs == nil {
+		s.attrs = map[string]string{}
+	}
+	s.attrs[key] = value
+}
+
+func (s *Span) Attributes() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return maps.Clone(s.attrs)
+}
+
+// SetError marks the span as failed
+func (s *Span) SetError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Err = err
+}
+
+// End records the end time and hands sampled spans to the exporter.
+// Only the first call counts
+func (s *Span) End() {
+	s.mu.Lock()
+	if s.finished {
+		s.mu.Unlock()
+		return
+	}
+	s.finished = true
+	s.EndTime = time.Now()
+	s.mu.Unlock()
+
+	if s.context.Sampled() && s.tracer.Exporter != nil {
+		s.tracer.Exporter.ExportSpan(s)
+	}
+}
+
+// Exporter receives every finished, sampled span
+type Exporter interface {
+	ExportSpan(span *Span)
+}
+
+type Tracer struct {
+	Exporter Exporter
+}
+
+func NewTracer(exporter Exporter) *Tracer {
+	return &Tracer{Exporter: exporter}
+}
+
+type spanKey struct{}
+
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// Start begins a span as a child of the one in ctx, or of remote when
+// that is valid, or as the root of a new sampled trace
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	return t.start(ctx, name, kind, SpanContext{})
+}
+
+// StartRemote begins a span whose parent lives in the caller's process
+func (t *Tracer) StartRemote(ctx context.Context, name string, kind SpanKind, remote SpanContext) (context.Context, *Span) {
+	return t.start(ctx, name, kind, remote)
+}
+
+func (t *Tracer) start(ctx context.Context, name string, kind SpanKind, remote SpanContext) (context.Context, *Span) {
+	span := &Span{Name: name, Kind: kind, StartTime: time.Now(), tracer: t}
+
+	parent := remote
+	if parent.IsValid() {
+		span.RemoteParent = true
+	} else if p := SpanFromContext(ctx); p != nil {
+		parent = p.SpanContext()
+	}
+
+	if parent.IsValid() {
+		span.context = parent
+		span.Parent = parent.SpanID
+	} else {
+		rand.Read(span.context.TraceID[:])
+		span.context.Flags = FlagSampled
+	}
+	rand.Read(span.context.SpanID[:])
+	return ContextWithSpan(ctx, span), span
+}
+
+// InMemoryExporter keeps exported spans for inspection, mostly in tests
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func (e *InMemoryExporter) ExportSpan(span *Span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+func (e *InMemoryExporter) Spans() []*Span {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*Span(nil), e.spans...)
+}
+
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
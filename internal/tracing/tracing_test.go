@@ -0,0 +1,99 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"boot.httpserver/internal/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestParseTraceparent(t *testing.T) {
+	sc, err := ParseTraceparent(traceparent)
+	require.NoError(t, err)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+	assert.True(t, sc.Sampled())
+	assert.Equal(t, traceparent, sc.Traceparent())
+
+	// Test: later versions may carry extra fields
+	_, err = ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra")
+	assert.NoError(t, err)
+
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+	} {
+		_, err := ParseTraceparent(invalid)
+		assert.ErrorIs(t, err, ErrInvalidTraceparent, invalid)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	h := headers.NewHeaders()
+	h["traceparent"] = traceparent
+	h["tracestate"] = "vendor=abc"
+	sc, ok := Extract(h)
+	require.True(t, ok)
+	assert.Equal(t, "vendor=abc", sc.TraceState)
+
+	// Test: tracestate is dropped with an invalid traceparent
+	h["traceparent"] = "garbage"
+	_, ok = Extract(h)
+	assert.False(t, ok)
+}
+
+func TestSpans(t *testing.T) {
+	exporter := &InMemoryExporter{}
+	tracer := NewTracer(exporter)
+	remote, err := ParseTraceparent(traceparent)
+	require.NoError(t, err)
+	remote.TraceState = "vendor=abc"
+
+	ctx, server := tracer.StartRemote(context.Background(), "GET /", SpanKindServer, remote)
+	_, client := tracer.Start(ctx, "proxy", SpanKindClient)
+
+	// Test: children share the trace with fresh span ids
+	assert.Equal(t, remote.TraceID, server.SpanContext().TraceID)
+	assert.Equal(t, remote.SpanID, server.Parent)
+	assert.True(t, server.RemoteParent)
+	assert.NotEqual(t, remote.SpanID, server.SpanContext().SpanID)
+	assert.Equal(t, server.SpanContext().SpanID, client.Parent)
+	assert.False(t, client.RemoteParent)
+
+	// Test: outgoing requests carry the current span
+	out := http.Header{}
+	Inject(ContextWithSpan(ctx, client), out)
+	assert.Equal(t, client.SpanContext().Traceparent(), out.Get("traceparent"))
+	assert.Equal(t, "vendor=abc", out.Get("tracestate"))
+
+	client.End()
+	server.End()
+	server.End()
+	spans := exporter.Spans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "proxy", spans[0].Name)
+	assert.False(t, spans[1].EndTime.Before(spans[1].StartTime))
+
+	// Test: a new trace is started without a parent
+	_, root := tracer.Start(context.Background(), "root", SpanKindInternal)
+	assert.True(t, root.SpanContext().IsValid())
+	assert.False(t, root.Parent.IsValid())
+
+	// Test: unsampled traces are not exported
+	exporter.Reset()
+	remote.Flags = 0
+	_, unsampled := tracer.StartRemote(context.Background(), "GET /", SpanKindServer, remote)
+	unsampled.End()
+	assert.Empty(t, exporter.Spans())
+}
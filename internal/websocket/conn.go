@@ -0,0 +1,395 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+type MessageType int
+
+const (
+	continuationFrame MessageType = 0x0
+	TextMessage       MessageType = 0x1
+	BinaryMessage     MessageType = 0x2
+	CloseMessage      MessageType = 0x8
+	PingMessage       MessageType = 0x9
+	PongMessage       MessageType = 0xA
+)
+
+const (
+	CloseNormalClosure     = 1000
+	CloseGoingAway         = 1001
+	CloseProtocolError     = 1002
+	CloseUnsupportedData   = 1003
+	CloseNoStatusReceived  = 1005
+	CloseAbnormalClosure   = 1006
+	CloseInvalidPayload    = 1007
+	ClosePolicyViolation   = 1008
+	CloseMessageTooBig     = 1009
+	CloseInternalServerErr = 1011
+)
+
+const (
+	finBit  = 0x80
+	rsvBits = 0x70
+	maskBit = 0x80
+
+	maxControlPayload = 125
+	closeTimeout      = 5 * time.Second
+)
+
+// DefaultMaxMessageSize bounds messages unless MaxMessageSize says
+// otherwise, so a peer can't make the reader allocate whatever length it
+// claims
+const DefaultMaxMessageSize = 32 << 20
+
+var ErrClosed = errors.New("websocket: connection closed")
+
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket: close %d %s", e.Code, e.Text)
+}
+
+type Conn struct {
+	// largest message ReadMessage will assemble, 0 means
+	// DefaultMaxMessageSize
+	MaxMessageSize int64
+
+	conn     net.Conn
+	br       *bufio.Reader
+	isServer bool
+
+	writeMu   sync.Mutex
+	closeSent bool
+}
+
+// NewConn wraps an established connection. A server expects masked
+// frames from its peer and sends unmasked ones; a client does the reverse
+func NewConn(conn net.Conn, isServer bool) *Conn {
+	return newConn(conn, nil, isServer)
+}
+
+// buffered holds frames that arrived along with the handshake
+func newConn(conn net.Conn, buffered []byte, isServer bool) *Conn {
+	var r io.Reader = conn
+	if len(buffered) > 0 {
+		r = io.MultiReader(bytes.NewReader(buffered), conn)
+	}
+	return &Conn{
+		MaxMessageSize: DefaultMaxMessageSize,
+		conn:           conn,
+		br:             bufio.NewReader(r),
+		isServer:       isServer,
+	}
+}
+
+func (c *Conn) maxMessageSize() int64 {
+	if c.MaxMessageSize <= 0 {
+		return DefaultMaxMessageSize
+	}
+	return c.MaxMessageSize
+}
+
+func (c *Conn) NetConn() net.Conn {
+	return c.conn
+}
+
+type frame struct {
+	fin     bool
+	opcode  MessageType
+	payload []byte
+}
+
+// ReadMessage returns the next complete data message, reassembling
+// fragments. Pings are answered and pongs dropped along the way; a close
+// frame is echoed and surfaces as a *CloseError
+func (c *Conn) ReadMessage() (MessageType, []byte, error) {
+	var messageType MessageType
+	var message []byte
+
+	for {
+		f, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch f.opcode {
+		case PingMessage:
+			if err := c.writeFrame(PongMessage, f.payload, true); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			continue
+		case CloseMessage:
+			return 0, nil, c.handleClose(f.payload)
+		case continuationFrame:
+			if messageType == 0 {
+				return 0, nil, c.fail(CloseProtocolError, "continuation frame without a message")
+			}
+		case TextMessage, BinaryMessage:
+			if messageType != 0 {
+				return 0, nil, c.fail(CloseProtocolError, "new message before the previous one finished")
+			}
+			messageType = f.opcode
+		}
+
+		if int64(len(message)+len(f.payload)) > c.maxMessageSize() {
+			return 0, nil, c.fail(CloseMessageTooBig, "message too big")
+		}
+		message = append(message, f.payload...)
+
+		if f.fin {
+			if messageType == TextMessage && !utf8.Valid(message) {
+				return 0, nil, c.fail(CloseInvalidPayload, "invalid utf-8 in text message")
+			}
+			return messageType, message, nil
+		}
+	}
+}
+
+func (c *Conn) readFrame() (frame, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		return frame{}, err
+	}
+
+	f := frame{
+		fin:    header[0]&finBit != 0,
+		opcode: MessageType(header[0] & 0x0F),
+	}
+	masked := header[1]&maskBit != 0
+	length := uint64(header[1] & 0x7F)
+
+	if header[0]&rsvBits != 0 {
+		return frame{}, c.fail(CloseProtocolError, "reserved bits set without an extension")
+	}
+	switch f.opcode {
+	case continuationFrame, TextMessage, BinaryMessage:
+	case CloseMessage, PingMessage, PongMessage:
+		if !f.fin {
+			return frame{}, c.fail(CloseProtocolError, "fragmented control frame")
+		}
+		if length > maxControlPayload {
+			return frame{}, c.fail(CloseProtocolError, "control frame too long")
+		}
+	default:
+		return frame{}, c.fail(CloseProtocolError, "unknown opcode")
+	}
+	if masked != c.isServer {
+		return frame{}, c.fail(CloseProtocolError, "bad frame masking")
+	}
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return frame{}, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return frame{}, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+		if length>>63 != 0 {
+			return frame{}, c.fail(CloseProtocolError, "invalid payload length")
+		}
+	}
+	if length > uint64(c.maxMessageSize()) {
+		return frame{}, c.fail(CloseMessageTooBig, "message too big")
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+			return frame{}, err
+		}
+	}
+
+	f.payload = make([]byte, length)
+	if _, err := io.ReadFull(c.br, f.payload); err != nil {
+		return frame{}, err
+	}
+	if masked {
+		maskBytes(mask, f.payload)
+	}
+	return f, nil
+}
+
+func (c *Conn) handleClose(payload []byte) error {
+	code, text := CloseNoStatusReceived, ""
+	switch {
+	case len(payload) == 1:
+		return c.fail(CloseProtocolError, "invalid close payload")
+	case len(payload) >= 2:
+		code = int(binary.BigEndian.Uint16(payload))
+		text = string(payload[2:])
+		if !validCloseCode(code) {
+			return c.fail(CloseProtocolError, "invalid close code")
+		}
+		if !utf8.ValidString(text) {
+			return c.fail(CloseInvalidPayload, "invalid utf-8 in close reason")
+		}
+	}
+
+	// echo the close unless we started the handshake
+	echo := CloseNormalClosure
+	if code != CloseNoStatusReceived {
+		echo = code
+	}
+	c.writeClose(echo, "")
+	c.conn.Close()
+	return &CloseError{Code: code, Text: text}
+}
+
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003:
+		return true
+	case code >= 1007 && code <= 1011:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+// fail sends a close frame with code, drops the connection and returns
+// the matching error
+func (c *Conn) fail(code int, text string) error {
+	c.writeClose(code, text)
+	c.conn.Close()
+	return &CloseError{Code: code, Text: text}
+}
+
+func (c *Conn) WriteMessage(messageType MessageType, data []byte) error {
+	return c.WriteFragments(messageType, data)
+}
+
+// WriteFragments sends one message split across a frame per fragment
+func (c *Conn) WriteFragments(messageType MessageType, fragments ...[]byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return errors.New("websocket: fragments must be a text or binary message")
+	}
+	if len(fragments) == 0 {
+		fragments = [][]byte{nil}
+	}
+	for i, fragment := range fragments {
+		opcode := messageType
+		if i > 0 {
+			opcode = continuationFrame
+		}
+		if err := c.writeFrame(opcode, fragment, i == len(fragments)-1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Conn) Ping(data []byte) error {
+	if len(data) > maxControlPayload {
+		return errors.New("websocket: ping payload too long")
+	}
+	return c.writeFrame(PingMessage, data, true)
+}
+
+// Close starts the closing handshake and waits briefly for the peer to
+// answer before dropping the connection
+func (c *Conn) Close(code int, text string) error {
+	if err := c.writeClose(code, text); err != nil {
+		c.conn.Close()
+		return err
+	}
+	c.conn.SetReadDeadline(time.Now().Add(closeTimeout))
+	for {
+		f, err := c.readFrame()
+		if err != nil || f.opcode == CloseMessage {
+			break
+		}
+	}
+	return c.conn.Close()
+}
+
+// writeClose is a no-op once a close frame has gone out
+func (c *Conn) writeClose(code int, text string) error {
+	payload := make([]byte, 2, 2+len(text))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, text...)
+	if len(payload) > maxControlPayload {
+		payload = payload[:maxControlPayload]
+	}
+	if err := c.writeFrame(CloseMessage, payload, true); err != ErrClosed {
+		return err
+	}
+	return nil
+}
+
+func (c *Conn) writeFrame(opcode MessageType, payload []byte, fin bool) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closeSent {
+		return ErrClosed
+	}
+	if opcode == CloseMessage {
+		c.closeSent = true
+	}
+
+	buf := make([]byte, 0, 14+len(payload))
+	first := byte(opcode)
+	if fin {
+		first |= finBit
+	}
+	buf = append(buf, first)
+
+	var maskFlag byte
+	if !c.isServer {
+		maskFlag = maskBit
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		buf = append(buf, maskFlag|byte(n))
+	case n <= 0xFFFF:
+		buf = append(buf, maskFlag|126)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(n))
+	default:
+		buf = append(buf, maskFlag|127)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(n))
+	}
+
+	if c.isServer {
+		buf = append(buf, payload...)
+	} else {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return err
+		}
+		buf = append(buf, mask[:]...)
+		start := len(buf)
+		buf = append(buf, payload...)
+		maskBytes(mask, buf[start:])
+	}
+
+	_, err := c.conn.Write(buf)
+	return err
+}
+
+func maskBytes(mask [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= mask[i%4]
+	}
+}
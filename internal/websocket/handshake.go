@@ -0,0 +1,143 @@
+package websocket
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"boot.httpserver/internal/headers"
+	"boot.httpserver/internal/request"
+	"boot.httpserver/internal/response"
+	"boot.httpserver/internal/server"
+)
+
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+var ErrBadHandshake = errors.New("websocket: bad handshake")
+
+type Upgrader struct {
+	// subprotocols offered by the server, in order of preference
+	Subprotocols []string
+	// when nil only requests without an Origin or from the same host as
+	// the Host header are accepted; return true to accept any origin
+	CheckOrigin func(req *request.Request) bool
+	// largest message ReadMessage will assemble, 0 means
+	// DefaultMaxMessageSize
+	MaxMessageSize int64
+}
+
+func Upgrade(w *response.Writer, req *request.Request) (*Conn, error) {
+	u := &Upgrader{}
+	return u.Upgrade(w, req)
+}
+
+// Upgrade validates the opening handshake, answers 101 Switching
+// Protocols and takes over the connection. On failure an error response
+// has already been written
+func (u *Upgrader) Upgrade(w *response.Writer, req *request.Request) (*Conn, error) {
+	if req.RequestLine.Method != "GET" {
+		return nil, reject(w, req, response.METHODNOTALLOWED, "websocket handshake must be a GET")
+	}
+	if !headerHasToken(req.Headers, "Connection", "upgrade") {
+		return nil, reject(w, req, response.BADREQUEST, "missing Connection: upgrade")
+	}
+	if !headerHasToken(req.Headers, "Upgrade", "websocket") {
+		return nil, reject(w, req, response.BADREQUEST, "missing Upgrade: websocket")
+	}
+	if version, _ := req.Headers.Get("Sec-WebSocket-Version"); version != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return nil, reject(w, req, response.UPGRADEREQUIRED, "unsupported websocket version")
+	}
+	key, _ := req.Headers.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return nil, reject(w, req, response.BADREQUEST, "invalid Sec-WebSocket-Key")
+	}
+	checkOrigin := u.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+	if !checkOrigin(req) {
+		return nil, reject(w, req, response.FORBIDDEN, "origin not allowed")
+	}
+
+	conn, buffered, err := w.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	h := headers.NewHeaders()
+	h.Set("Upgrade", "websocket")
+	h.Set("Connection", "Upgrade")
+	h.Set("Sec-WebSocket-Accept", AcceptKey(key))
+	if protocol := u.selectSubprotocol(req); protocol != "" {
+		h.Set("Sec-WebSocket-Protocol", protocol)
+	}
+	if err := response.WriteStatus(conn, response.SWITCHINGPROTOCOLS); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := response.WriteHeaders(conn, h); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	c := newConn(conn, buffered, true)
+	if u.MaxMessageSize > 0 {
+		c.MaxMessageSize = u.MaxMessageSize
+	}
+	return c, nil
+}
+
+func AcceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// sameOrigin keeps browsers on other sites from opening connections with
+// the user's cookies. Clients that send no Origin aren't browsers
+func sameOrigin(req *request.Request) bool {
+	origin, ok := req.Headers.Get("Origin")
+	if !ok {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	host, _ := req.Headers.Get("Host")
+	return strings.EqualFold(u.Host, host)
+}
+
+func (u *Upgrader) selectSubprotocol(req *request.Request) string {
+	value, ok := req.Headers.Get("Sec-WebSocket-Protocol")
+	if !ok {
+		return ""
+	}
+	for _, offered := range u.Subprotocols {
+		for _, requested := range strings.Split(value, ",") {
+			if strings.TrimSpace(requested) == offered {
+				return offered
+			}
+		}
+	}
+	return ""
+}
+
+func headerHasToken(h headers.Headers, name, token string) bool {
+	value, _ := h.Get(name)
+	for _, t := range strings.Split(value, ",") {
+		if strings.EqualFold(strings.TrimSpace(t), token) {
+			return true
+		}
+	}
+	return false
+}
+
+// reject answers a failed handshake and returns the matching error
+func reject(w *response.Writer, req *request.Request, statusCode response.StatusCode, message string) error {
+	server.WriteError(w, req, statusCode, message)
+	return fmt.Errorf("%w: %s", ErrBadHandshake, message)
+}
@@ -0,0 +1,262 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"net/http"
+	"testing"
+
+	"boot.httpserver/internal/request"
+	"boot.httpserver/internal/response"
+	"boot.httpserver/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func handshakeRequest(h map[string]string) *request.Request {
+	req := testutil.NewRequest("GET", "/ws", map[string]string{
+		"host":                  "localhost:42069",
+		"connection":            "keep-alive, Upgrade",
+		"upgrade":               "websocket",
+		"sec-websocket-version": "13",
+		"sec-websocket-key":     "dGhlIHNhbXBsZSBub25jZQ==",
+	})
+	for k, v := range h {
+		req.Headers[k] = v
+	}
+	return req
+}
+
+func pipe() (*Conn, *Conn) {
+	serverEnd, clientEnd := net.Pipe()
+	return NewConn(serverEnd, true), NewConn(clientEnd, false)
+}
+
+func TestUpgrade(t *testing.T) {
+	serverEnd, clientEnd := net.Pipe()
+	defer clientEnd.Close()
+
+	responses := make(chan *http.Response, 1)
+	go func() {
+		res, err := http.ReadResponse(bufio.NewReader(clientEnd), nil)
+		if err == nil {
+			responses <- res
+		}
+		close(responses)
+	}()
+
+	w := &response.Writer{Wrt: &bytes.Buffer{}, Conn: serverEnd}
+	u := &Upgrader{Subprotocols: []string{"chat"}}
+	conn, err := u.Upgrade(w, handshakeRequest(map[string]string{"sec-websocket-protocol": "superchat, chat"}))
+	require.NoError(t, err)
+	require.NotNil(t, conn)
+	assert.True(t, w.Hijacked())
+
+	res := <-responses
+	require.NotNil(t, res)
+	assert.Equal(t, 101, res.StatusCode)
+	assert.Equal(t, "websocket", res.Header.Get("Upgrade"))
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", res.Header.Get("Sec-WebSocket-Accept"))
+	assert.Equal(t, "chat", res.Header.Get("Sec-WebSocket-Protocol"))
+}
+
+func TestUpgradeRejected(t *testing.T) {
+	cases := []struct {
+		name   string
+		h      map[string]string
+		status string
+	}{
+		{"missing upgrade", map[string]string{"upgrade": "h2c"}, "400 Bad Request"},
+		{"missing connection token", map[string]string{"connection": "keep-alive"}, "400 Bad Request"},
+		{"bad key", map[string]string{"sec-websocket-key": "c2hvcnQ="}, "400 Bad Request"},
+		{"old version", map[string]string{"sec-websocket-version": "8"}, "426 Upgrade Required"},
+		{"cross origin", map[string]string{"origin": "https://evil.example"}, "403 Forbidden"},
+	}
+	for _, c := range cases {
+		serverEnd, clientEnd := net.Pipe()
+		buf := &bytes.Buffer{}
+		w := &response.Writer{Wrt: buf, Conn: serverEnd}
+		_, err := Upgrade(w, handshakeRequest(c.h))
+		assert.ErrorIs(t, err, ErrBadHandshake, c.name)
+		assert.False(t, w.Hijacked(), c.name)
+		w.Finish()
+		assert.Contains(t, buf.String(), c.status, c.name)
+		if c.status == "426 Upgrade Required" {
+			assert.Contains(t, buf.String(), "Sec-WebSocket-Version: 13\r\n")
+		}
+		serverEnd.Close()
+		clientEnd.Close()
+	}
+}
+
+func TestMessages(t *testing.T) {
+	server, client := pipe()
+	defer server.NetConn().Close()
+	defer client.NetConn().Close()
+
+	// Test: masked text message
+	go client.WriteMessage(TextMessage, []byte("hello"))
+	messageType, data, err := server.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, TextMessage, messageType)
+	assert.Equal(t, "hello", string(data))
+
+	// Test: unmasked server reply
+	go server.WriteMessage(BinaryMessage, []byte{1, 2, 3})
+	messageType, data, err = client.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, BinaryMessage, messageType)
+	assert.Equal(t, []byte{1, 2, 3}, data)
+
+	// Test: extended payload lengths
+	big := bytes.Repeat([]byte("x"), 70000)
+	go client.WriteMessage(BinaryMessage, big)
+	_, data, err = server.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, big, data)
+}
+
+func TestFragmentationWithPing(t *testing.T) {
+	server, client := pipe()
+	defer server.NetConn().Close()
+	defer client.NetConn().Close()
+
+	go func() {
+		client.writeFrame(TextMessage, []byte("frag"), false)
+		client.writeFrame(PingMessage, []byte("are you there"), true)
+		client.writeFrame(continuationFrame, []byte("mented"), true)
+	}()
+
+	pongs := make(chan frame, 1)
+	go func() {
+		f, err := client.readFrame()
+		if err == nil {
+			pongs <- f
+		}
+	}()
+
+	messageType, data, err := server.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, TextMessage, messageType)
+	assert.Equal(t, "fragmented", string(data))
+
+	pong := <-pongs
+	assert.Equal(t, PongMessage, pong.opcode)
+	assert.Equal(t, "are you there", string(pong.payload))
+}
+
+func TestProtocolErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		raw  []byte
+		code int
+	}{
+		{"unmasked client frame", []byte{0x81, 0x02, 'h', 'i'}, CloseProtocolError},
+		{"reserved bits", []byte{0xC1, 0x80, 0, 0, 0, 0}, CloseProtocolError},
+		{"unknown opcode", []byte{0x83, 0x80, 0, 0, 0, 0}, CloseProtocolError},
+		{"fragmented ping", []byte{0x09, 0x80, 0, 0, 0, 0}, CloseProtocolError},
+		{"orphan continuation", []byte{0x80, 0x80, 0, 0, 0, 0}, CloseProtocolError},
+		{"invalid utf-8", []byte{0x81, 0x82, 0, 0, 0, 0, 0xC3, 0x28}, CloseInvalidPayload},
+		{"invalid close code", []byte{0x88, 0x82, 0, 0, 0, 0, 0x03, 0xED}, CloseProtocolError},
+	}
+	for _, c := range cases {
+		server, client := pipe()
+		go client.NetConn().Write(c.raw)
+
+		closes := make(chan frame, 1)
+		go func() {
+			f, err := client.readFrame()
+			if err == nil {
+				closes <- f
+			}
+			close(closes)
+		}()
+
+		_, _, err := server.ReadMessage()
+		var closeErr *CloseError
+		require.ErrorAs(t, err, &closeErr, c.name)
+		assert.Equal(t, c.code, closeErr.Code, c.name)
+
+		f, ok := <-closes
+		require.True(t, ok, c.name)
+		assert.Equal(t, CloseMessage, f.opcode, c.name)
+		client.NetConn().Close()
+	}
+}
+
+func TestMessageTooBig(t *testing.T) {
+	server, client := pipe()
+	defer client.NetConn().Close()
+	server.MaxMessageSize = 4
+
+	go func() {
+		client.writeFrame(TextMessage, []byte("abc"), false)
+		client.writeFrame(continuationFrame, []byte("def"), true)
+	}()
+	go client.readFrame()
+
+	_, _, err := server.ReadMessage()
+	var closeErr *CloseError
+	require.ErrorAs(t, err, &closeErr)
+	assert.Equal(t, CloseMessageTooBig, closeErr.Code)
+}
+
+func TestOversizedLengthHeader(t *testing.T) {
+	server, client := pipe()
+	defer client.NetConn().Close()
+
+	// Test: a length near 2^63 fails before anything is allocated
+	raw := []byte{0x82, 0xFF, 0x7F, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0, 0, 0, 0}
+	go client.NetConn().Write(raw)
+
+	closes := make(chan frame, 1)
+	go func() {
+		f, err := client.readFrame()
+		if err == nil {
+			closes <- f
+		}
+		close(closes)
+	}()
+
+	_, _, err := server.ReadMessage()
+	var closeErr *CloseError
+	require.ErrorAs(t, err, &closeErr)
+	assert.Equal(t, CloseMessageTooBig, closeErr.Code)
+
+	f, ok := <-closes
+	require.True(t, ok)
+	assert.Equal(t, CloseMessage, f.opcode)
+	assert.Equal(t, []byte{0x03, 0xF1}, f.payload[:2])
+}
+
+func TestOrigin(t *testing.T) {
+	// Test: same host as the Host header is accepted by default
+	req := handshakeRequest(map[string]string{"origin": "http://LOCALHOST:42069"})
+	assert.True(t, sameOrigin(req))
+
+	// Test: no Origin means no browser
+	assert.True(t, sameOrigin(handshakeRequest(nil)))
+
+	// Test: another port is another origin
+	req = handshakeRequest(map[string]string{"origin": "http://localhost:8080"})
+	assert.False(t, sameOrigin(req))
+}
+
+func TestCloseHandshake(t *testing.T) {
+	server, client := pipe()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- client.Close(CloseGoingAway, "bye")
+	}()
+
+	_, _, err := server.ReadMessage()
+	var closeErr *CloseError
+	require.ErrorAs(t, err, &closeErr)
+	assert.Equal(t, CloseGoingAway, closeErr.Code)
+	assert.Equal(t, "bye", closeErr.Text)
+
+	require.NoError(t, <-done)
+	assert.ErrorIs(t, server.WriteMessage(TextMessage, []byte("late")), ErrClosed)
+}